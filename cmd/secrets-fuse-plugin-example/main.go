@@ -0,0 +1,153 @@
+// Command secrets-fuse-plugin-example is a reference secrets-fuse plugin.
+// It stores example://name references in a JSON file (or in memory when
+// -store is empty) and speaks the plugin protocol on stdin/stdout:
+//
+//	{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocol_version":1}}
+//	{"jsonrpc":"2.0","id":1,"result":{"protocol_version":1,"name":"example","capabilities":{"write":true,"list":true}}}
+//
+// Methods are initialize, name, resolve {reference}, write {reference, value}
+// and list.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+type request struct {
+	ID     uint64          `json:"id"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type response struct {
+	JSONRPC string    `json:"jsonrpc"`
+	ID      uint64    `json:"id"`
+	Result  any       `json:"result,omitempty"`
+	Error   *rpcError `json:"error,omitempty"`
+}
+
+type store struct {
+	path    string
+	secrets map[string]string
+}
+
+func (s *store) load() error {
+	s.secrets = make(map[string]string)
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.secrets)
+}
+
+func (s *store) save() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *store) handle(req request) (any, error) {
+	var params struct {
+		Reference string `json:"reference"`
+		Value     string `json:"value"`
+	}
+	if len(req.Params) > 0 {
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			return nil, fmt.Errorf("invalid params: %w", err)
+		}
+	}
+	if params.Reference != "" && !strings.HasPrefix(params.Reference, "example://") {
+		return nil, fmt.Errorf("unsupported reference %q", params.Reference)
+	}
+
+	switch req.Method {
+	case "initialize":
+		return map[string]any{
+			"protocol_version": 1,
+			"name":             "example",
+			"capabilities":     map[string]bool{"write": true, "list": true},
+		}, nil
+	case "name":
+		return map[string]string{"name": "example"}, nil
+	case "resolve":
+		val, ok := s.secrets[params.Reference]
+		if !ok {
+			return nil, fmt.Errorf("secret %q not found", params.Reference)
+		}
+		return map[string]string{"value": val}, nil
+	case "write":
+		s.secrets[params.Reference] = params.Value
+		return map[string]any{}, s.save()
+	case "list":
+		refs := make([]string, 0, len(s.secrets))
+		for ref := range s.secrets {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		return map[string][]string{"references": refs}, nil
+	}
+	return nil, fmt.Errorf("method %q not found", req.Method)
+}
+
+func main() {
+	storePath := flag.String("store", "", "JSON file to persist secrets in (default: in memory)")
+	flag.Parse()
+
+	// stdout carries the protocol, so logs go to stderr
+	log.SetOutput(os.Stderr)
+
+	s := &store{path: *storePath}
+	if err := s.load(); err != nil {
+		log.Fatalf("loading store: %v", err)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	enc := json.NewEncoder(os.Stdout)
+
+	for scanner.Scan() {
+		var req request
+		resp := response{JSONRPC: "2.0"}
+		if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+			resp.Error = &rpcError{Code: -32700, Message: err.Error()}
+		} else {
+			resp.ID = req.ID
+			result, err := s.handle(req)
+			if err != nil {
+				resp.Error = &rpcError{Code: -32000, Message: err.Error()}
+			} else {
+				resp.Result = result
+			}
+		}
+		if err := enc.Encode(resp); err != nil {
+			log.Fatalf("writing response: %v", err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+//go:build linux && privileged
+
+package fuse
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Run with: go test -tags privileged ./fuse (as root)
+func TestAllowOtherUIDs(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat not found")
+	}
+	mountPoint := t.TempDir()
+	// Let other users reach the mount point
+	for dir := mountPoint; dir != os.TempDir(); dir = filepath.Dir(dir) {
+		os.Chmod(dir, 0o755)
+	}
+
+	const nobody = 65534
+	manager := NewMockSecretManager()
+	manager.secrets["op://test/item/root"] = "root-value"
+	manager.secrets["op://test/item/nobody"] = "nobody-value"
+	secrets := []SecretConfig{
+		{Reference: "op://test/item/root", Filename: "root.txt", AllowedUIDs: []uint32{0}},
+		{Reference: "op://test/item/nobody", Filename: "nobody.txt", AllowedUIDs: []uint32{nobody}},
+	}
+	root := NewSecretRoot(manager, secrets, 0)
+
+	zero := time.Duration(0)
+	server, err := fs.Mount(mountPoint, root, &fs.Options{
+		MountOptions:    fuse.MountOptions{DirectMount: true, AllowOther: true},
+		AttrTimeout:     &zero,
+		EntryTimeout:    &zero,
+		NegativeTimeout: &zero,
+	})
+	if err != nil {
+		t.Skipf("mount: %v", err)
+	}
+	defer server.Unmount()
+
+	catAs := func(uid uint32, name string) (string, error) {
+		cmd := exec.Command(cat, filepath.Join(mountPoint, name))
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uid, Gid: uid}}
+		out, err := cmd.CombinedOutput()
+		return string(out), err
+	}
+
+	if out, err := catAs(0, "root.txt"); err != nil || out != "root-value" {
+		t.Errorf("root reading root.txt: %q, %v", out, err)
+	}
+	if out, err := catAs(nobody, "root.txt"); err == nil {
+		t.Errorf("nobody reading root.txt should be denied, got %q", out)
+	}
+	if out, err := catAs(nobody, "nobody.txt"); err != nil || out != "nobody-value" {
+		t.Errorf("nobody reading nobody.txt: %q, %v", out, err)
+	}
+}
+
+func TestAllowOtherWrites(t *testing.T) {
+	mountPoint := t.TempDir()
+	for dir := mountPoint; dir != os.TempDir(); dir = filepath.Dir(dir) {
+		os.Chmod(dir, 0o755)
+	}
+
+	const nobody = 65534
+	manager := NewMockSecretManager()
+	manager.secrets["op://test/item/rw"] = "original"
+	manager.secrets["op://test/item/ro"] = "read-only"
+	secrets := []SecretConfig{
+		{Reference: "op://test/item/rw", Filename: "rw.txt", AllowedUIDs: []uint32{0}, Writable: true},
+		{Reference: "op://test/item/ro", Filename: "ro.txt", AllowedUIDs: []uint32{0}},
+	}
+	root := NewSecretRoot(manager, secrets, 0)
+
+	zero := time.Duration(0)
+	server, err := fs.Mount(mountPoint, root, &fs.Options{
+		MountOptions:    fuse.MountOptions{DirectMount: true, AllowOther: true},
+		AttrTimeout:     &zero,
+		EntryTimeout:    &zero,
+		NegativeTimeout: &zero,
+	})
+	if err != nil {
+		t.Skipf("mount: %v", err)
+	}
+	defer server.Unmount()
+
+	runAs := func(uid uint32, name string, args ...string) error {
+		cmd := exec.Command(name, args...)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Credential: &syscall.Credential{Uid: uid, Gid: uid}}
+		return cmd.Run()
+	}
+
+	// Root may stage a file, as editors do when saving
+	scratch := filepath.Join(mountPoint, "scratch")
+	if err := os.Mkdir(scratch, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(scratch, "staged"), []byte("staged"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another user can't create scratch space or rename over the secret
+	if err := runAs(nobody, "mkdir", filepath.Join(mountPoint, "evil")); err == nil {
+		t.Error("nobody creating a directory should be denied")
+	}
+	if err := runAs(nobody, "mv", filepath.Join(scratch, "staged"), filepath.Join(mountPoint, "rw.txt")); err == nil {
+		t.Error("nobody renaming over rw.txt should be denied")
+	}
+	if manager.secrets["op://test/item/rw"] != "original" {
+		t.Errorf("secret overwritten by another user: %q", manager.secrets["op://test/item/rw"])
+	}
+
+	// Renames still respect the writable flag
+	if err := os.Rename(filepath.Join(scratch, "staged"), filepath.Join(mountPoint, "ro.txt")); err == nil {
+		t.Error("renaming over a read-only secret should be denied")
+	}
+	if err := os.Rename(filepath.Join(scratch, "staged"), filepath.Join(mountPoint, "rw.txt")); err != nil {
+		t.Errorf("root renaming over rw.txt: %v", err)
+	}
+	if manager.secrets["op://test/item/rw"] != "staged" {
+		t.Errorf("secret after rename: %q", manager.secrets["op://test/item/rw"])
+	}
+}
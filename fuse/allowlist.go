@@ -0,0 +1,342 @@
+package fuse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// CmdRule is one allowlist entry. Every field that is set must match.
+type CmdRule struct {
+	Cmd          string   // glob matched against the command line or executable
+	SHA256       string   // hex SHA-256 of the caller's executable
+	ScriptSHA256 string   // hex SHA-256 of the script run by an interpreter
+	Ancestor     string   // glob some ancestor process must match
+	NotAncestors []string // globs no ancestor process may match
+}
+
+// allows reports whether the caller satisfies the rule
+func (r CmdRule) allows(id *callerIdentity) bool {
+	if r.Cmd != "" && !matchesCmd(r.Cmd, id.cmdline()) {
+		return false
+	}
+	if r.SHA256 != "" {
+		sum, err := id.exeHash()
+		if err != nil {
+			log.Printf("Hashing executable %s: %v", id.exe, err)
+			return false
+		}
+		if !strings.EqualFold(sum, r.SHA256) {
+			return false
+		}
+	}
+	if r.ScriptSHA256 != "" {
+		sum, err := id.scriptHash()
+		if err != nil {
+			log.Printf("Hashing script of pid %d: %v", id.pid, err)
+			return false
+		}
+		if !strings.EqualFold(sum, r.ScriptSHA256) {
+			return false
+		}
+	}
+	if r.Ancestor != "" || len(r.NotAncestors) > 0 {
+		lineage, err := id.ancestors()
+		// Only exclusions depend on the part of the tree beyond the bound
+		if err != nil && (len(r.NotAncestors) > 0 || !errors.Is(err, errAncestryTooDeep)) {
+			log.Printf("Ancestry of pid %d: %v", id.pid, err)
+			return false
+		}
+		if r.Ancestor != "" && !slices.ContainsFunc(lineage, matchesAncestor(r.Ancestor, true)) {
+			return false
+		}
+		for _, pattern := range r.NotAncestors {
+			if slices.ContainsFunc(lineage, matchesAncestor(pattern, false)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchesAncestor matches an ancestor's command line or executable path
+// against pattern. A process can set its own argv (exec -a), so when the
+// match grants access its command line only counts if argv[0] names the
+// executable; exclusions match any command line.
+func matchesAncestor(pattern string, verifyArgv0 bool) func(*callerIdentity) bool {
+	return func(a *callerIdentity) bool {
+		if a.exe != "" && matchesCmd(pattern, a.exe) {
+			return true
+		}
+		return matchesCmd(pattern, a.cmdline()) && (!verifyArgv0 || a.argv0MatchesExe())
+	}
+}
+
+// maxAncestors bounds the walk up the process tree
+const maxAncestors = 32
+
+var errAncestryTooDeep = fmt.Errorf("more than %d ancestors", maxAncestors)
+
+// ancestors pins the caller's parent chain, nearest first, up to the process
+// without a parent (init, or the root of a PID namespace).
+func (id *callerIdentity) ancestors() ([]*callerIdentity, error) {
+	if id.lineageDone {
+		return id.lineage, id.lineageErr
+	}
+	id.lineageDone = true
+
+	child := id
+	for range maxAncestors {
+		ppid, err := child.parentPid()
+		if err != nil {
+			id.lineageErr = err
+			return id.lineage, err
+		}
+		if ppid == 0 {
+			return id.lineage, nil
+		}
+		parent, err := captureAncestor(ppid)
+		if err != nil {
+			id.lineageErr = fmt.Errorf("parent %d of %d: %w", ppid, child.pid, err)
+			return id.lineage, id.lineageErr
+		}
+		// A child is reparented when its parent exits, so an unchanged PPid
+		// means the pinned process is still the parent and not a PID reuse
+		if again, err := child.parentPid(); err != nil || again != ppid {
+			parent.Close()
+			id.lineageErr = fmt.Errorf("parent of %d changed during check", child.pid)
+			return id.lineage, id.lineageErr
+		}
+		id.lineage = append(id.lineage, parent)
+		child = parent
+	}
+	id.lineageErr = errAncestryTooDeep
+	return id.lineage, id.lineageErr
+}
+
+// matchesCmd matches pattern against the full command line or just its
+// first argument (the executable name)
+func matchesCmd(pattern, cmdline string) bool {
+	if matched, _ := filepath.Match(pattern, cmdline); matched {
+		return true
+	}
+	matched, _ := filepath.Match(pattern, firstArg(cmdline))
+	return matched
+}
+
+// isAllowed checks the caller against the allowlist
+func isAllowed(rules []CmdRule, id *callerIdentity) bool {
+	if len(rules) == 0 {
+		return true // no allowlist = allow all
+	}
+	for _, rule := range rules {
+		if rule.allows(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// Policy decides which callers may open a secret. A caller must pass both
+// the user/group rules and the command rules; empty rules allow everyone.
+type Policy struct {
+	Cmds []CmdRule
+	UIDs []uint32
+	GIDs []uint32 // matched against primary and supplementary groups
+}
+
+func (p Policy) empty() bool {
+	return len(p.Cmds) == 0 && len(p.UIDs) == 0 && len(p.GIDs) == 0
+}
+
+// allowsUser checks the caller's filesystem user and groups
+func (p Policy) allowsUser(id *callerIdentity) bool {
+	if len(p.UIDs) == 0 && len(p.GIDs) == 0 {
+		return true
+	}
+	if slices.Contains(p.UIDs, id.uid) || slices.Contains(p.GIDs, id.gid) {
+		return true
+	}
+	return slices.ContainsFunc(id.groups, func(g uint32) bool { return slices.Contains(p.GIDs, g) })
+}
+
+// authorize applies policy to a pinned caller. The caller must still be the
+// same process when the decision is made.
+func authorize(id *callerIdentity, policy Policy) error {
+	if !policy.allowsUser(id) {
+		return fmt.Errorf("uid %d / gid %d not allowed", id.uid, id.gid)
+	}
+	if !id.argv0MatchesExe() {
+		return errors.New("cmdline/exe mismatch - possible spoofing")
+	}
+	if !isAllowed(policy.Cmds, id) {
+		return errors.New("not in allowlist")
+	}
+	if err := id.verify(); err != nil {
+		return fmt.Errorf("caller changed during check: %w", err)
+	}
+	for _, a := range id.lineage {
+		if err := a.verify(); err != nil {
+			return fmt.Errorf("ancestor changed during check: %w", err)
+		}
+	}
+	return nil
+}
+
+// scriptHash hashes the script an interpreter was started with, as the
+// caller sees it from its working directory
+func (id *callerIdentity) scriptHash() (string, error) {
+	script := scriptArg(id.args)
+	if script == "" {
+		return "", os.ErrNotExist
+	}
+	f, err := id.openScript(script)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	if !info.Mode().IsRegular() {
+		return "", fmt.Errorf("script %s is not a regular file", script)
+	}
+	return fileHash(f)
+}
+
+// interpreterOptions lists, per interpreter, the options whose value is the
+// next argument and the options that run code given on the command line
+var interpreterOptions = map[string]struct{ values, inline []string }{
+	"python": {
+		values: []string{"-W", "-X", "--check-hash-based-pycs"},
+		inline: []string{"-c", "-m"},
+	},
+	"node": {
+		values: []string{"-r", "--require", "--import", "--loader", "--experimental-loader", "-C", "--conditions", "--title", "--env-file"},
+		inline: []string{"-e", "--eval", "-p", "--print"},
+	},
+	"ruby": {
+		values: []string{"-C", "-E", "-I", "-r", "--encoding"},
+		inline: []string{"-e"},
+	},
+	"perl": {inline: []string{"-e", "-E"}},
+	"bash": {
+		values: []string{"-o", "-O", "+o", "+O", "--rcfile", "--init-file"},
+		inline: []string{"-c"},
+	},
+	"sh": {
+		values: []string{"-o", "+o"},
+		inline: []string{"-c"},
+	},
+}
+
+// scriptArg returns the script an interpreter was started with: the first
+// argument that isn't an option or an option's value. It is empty when the
+// code doesn't come from a file, as with python -c or a script on stdin.
+func scriptArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	opts := interpreterOptions[strings.TrimRight(filepath.Base(args[0]), "0123456789.")]
+	for i := 1; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--":
+			if i+1 < len(args) && args[i+1] != "-" {
+				return args[i+1]
+			}
+			return ""
+		case arg == "-" || slices.Contains(opts.inline, arg):
+			return ""
+		case slices.Contains(opts.values, arg):
+			i++
+		case !strings.HasPrefix(arg, "-") && !strings.HasPrefix(arg, "+"):
+			return arg
+		}
+	}
+	return ""
+}
+
+// fileID identifies a file, so a rewritten file replaces its cached hash
+type fileID struct {
+	dev, ino uint64
+}
+
+// hashEntry is the hash of one version of a file. The ctime catches writes
+// that restore the old mtime, as it can't be set from user space.
+type hashEntry struct {
+	size         int64
+	mtime, ctime time.Time
+	sum          string
+}
+
+// maxHashCache bounds the number of files whose hash is kept
+const maxHashCache = 256
+
+var (
+	hashCacheMu sync.Mutex
+	hashCache   = make(map[fileID]hashEntry)
+)
+
+// fileHash returns the hex SHA-256 of f's content, cached by inode and
+// version so repeated opens by the same binary don't rehash it
+func fileHash(f *os.File) (string, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+	var id fileID
+	version := hashEntry{size: info.Size(), mtime: info.ModTime()}
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if ok {
+		id = fileID{dev: uint64(st.Dev), ino: st.Ino}
+		version.ctime = statCtime(st)
+		hashCacheMu.Lock()
+		entry, cached := hashCache[id]
+		hashCacheMu.Unlock()
+		if cached && entry.size == version.size && entry.mtime.Equal(version.mtime) && entry.ctime.Equal(version.ctime) {
+			return entry.sum, nil
+		}
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, 0, info.Size())); err != nil {
+		return "", err
+	}
+	version.sum = hex.EncodeToString(h.Sum(nil))
+
+	if ok {
+		hashCacheMu.Lock()
+		if _, cached := hashCache[id]; !cached && len(hashCache) >= maxHashCache {
+			// Evict an arbitrary entry; a miss only costs rehashing one file
+			for old := range hashCache {
+				delete(hashCache, old)
+				break
+			}
+		}
+		hashCache[id] = version
+		hashCacheMu.Unlock()
+	}
+	return version.sum, nil
+}
+
+// HashFile returns the hex SHA-256 of the file at path, for pinning it in
+// an allowlist
+func HashFile(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return fileHash(f)
+}
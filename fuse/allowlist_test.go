@@ -0,0 +1,160 @@
+package fuse
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFileHash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bin")
+	if err := os.WriteFile(path, []byte("v1"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("v1"))
+	got, err := HashFile(path)
+	if err != nil || got != hex.EncodeToString(sum[:]) {
+		t.Fatalf("HashFile = %q, %v", got, err)
+	}
+
+	// A rewritten file gets a new mtime and is rehashed
+	if err := os.WriteFile(path, []byte("v2"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Time{}, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	sum = sha256.Sum256([]byte("v2"))
+	if got, _ := HashFile(path); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("after rewrite: got %q", got)
+	}
+
+	// Restoring the mtime after a rewrite still changes the ctime
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("v3"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, time.Time{}, info.ModTime()); err != nil {
+		t.Fatal(err)
+	}
+	sum = sha256.Sum256([]byte("v3"))
+	if got, _ := HashFile(path); got != hex.EncodeToString(sum[:]) {
+		t.Errorf("after rewrite with restored mtime: got %q", got)
+	}
+
+	// Each version replaced the last instead of piling up
+	st := info.Sys().(*syscall.Stat_t)
+	hashCacheMu.Lock()
+	_, cached := hashCache[fileID{dev: uint64(st.Dev), ino: st.Ino}]
+	hashCacheMu.Unlock()
+	if !cached {
+		t.Error("hash not cached by inode")
+	}
+}
+
+func TestFileHashCacheBounded(t *testing.T) {
+	dir := t.TempDir()
+	for i := range maxHashCache + 10 {
+		path := filepath.Join(dir, fmt.Sprint(i))
+		if err := os.WriteFile(path, []byte(path), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := HashFile(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	hashCacheMu.Lock()
+	defer hashCacheMu.Unlock()
+	if len(hashCache) > maxHashCache {
+		t.Errorf("hash cache holds %d entries, want at most %d", len(hashCache), maxHashCache)
+	}
+}
+
+func TestScriptArg(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"python3", "/opt/server.py", "--port", "80"}, "/opt/server.py"},
+		{[]string{"python3", "-u", "server.py"}, "server.py"},
+		{[]string{"python3", "-W", "ignore", "server.py"}, "server.py"},
+		{[]string{"/usr/bin/python3.12", "-X", "dev", "-u", "server.py"}, "server.py"},
+		{[]string{"python3", "-m", "http.server"}, ""},
+		{[]string{"python3", "-c", "print(1)"}, ""},
+		{[]string{"node", "--require", "dotenv/config", "app.js"}, "app.js"},
+		{[]string{"bash", "-o", "pipefail", "run.sh"}, "run.sh"},
+		{[]string{"bash", "--", "run.sh"}, "run.sh"},
+		{[]string{"bash", "-"}, ""},
+		{[]string{"python3"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := scriptArg(tt.args); got != tt.want {
+			t.Errorf("scriptArg(%q) = %q, want %q", tt.args, got, tt.want)
+		}
+	}
+}
+
+func TestCmdRuleHashes(t *testing.T) {
+	id, err := captureCaller(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum, err := HashFile(exe)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		rule CmdRule
+		want bool
+	}{
+		{"hash only", CmdRule{SHA256: sum}, true},
+		{"pattern and hash", CmdRule{Cmd: id.args[0], SHA256: sum}, true},
+		{"wrong pattern", CmdRule{Cmd: "/usr/bin/other", SHA256: sum}, false},
+		{"wrong hash", CmdRule{SHA256: "00" + sum[2:]}, false},
+	}
+	for _, tt := range tests {
+		if got := isAllowed([]CmdRule{tt.rule}, id); got != tt.want {
+			t.Errorf("%s: isAllowed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAllowsUser(t *testing.T) {
+	id := &callerIdentity{uid: 1000, gid: 1000, groups: []uint32{27, 1000}}
+	tests := []struct {
+		name   string
+		policy Policy
+		want   bool
+	}{
+		{"no rules", Policy{}, true},
+		{"uid", Policy{UIDs: []uint32{0, 1000}}, true},
+		{"other uid", Policy{UIDs: []uint32{1001}}, false},
+		{"primary gid", Policy{GIDs: []uint32{1000}}, true},
+		{"supplementary gid", Policy{GIDs: []uint32{27}}, true},
+		{"other gid", Policy{GIDs: []uint32{4}}, false},
+		{"uid or gid", Policy{UIDs: []uint32{1001}, GIDs: []uint32{27}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.allowsUser(id); got != tt.want {
+			t.Errorf("%s: allowsUser = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
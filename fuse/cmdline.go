@@ -21,6 +21,8 @@ func getCmdline(pid uint32) string {
 	return strings.Join(cmdline, " ")
 }
 
+// validateCmdlineExe checks argv[0] against the executable by PID alone,
+// for when the caller can't be pinned
 func validateCmdlineExe(pid uint32) bool {
 	proc, err := process.NewProcess(int32(pid))
 	if err != nil {
@@ -54,3 +56,29 @@ func validateCmdlineExe(pid uint32) bool {
 
 	return os.SameFile(realExe, realCmd)
 }
+
+// cmdline returns the caller's arguments joined by spaces, as getCmdline does
+func (id *callerIdentity) cmdline() string {
+	return strings.Join(id.args, " ")
+}
+
+// argv0MatchesExe reports whether the caller's argv[0] names the executable
+// it is running, so a process can't pose as another by rewriting argv.
+func (id *callerIdentity) argv0MatchesExe() bool {
+	if len(id.args) == 0 || id.args[0] == "" {
+		return false
+	}
+	if id.exe == id.args[0] {
+		return true
+	}
+
+	realExe, err := id.exeInfo()
+	if err != nil {
+		return false
+	}
+	realCmd, err := os.Stat(id.args[0])
+	if err != nil {
+		return false
+	}
+	return os.SameFile(realExe, realCmd)
+}
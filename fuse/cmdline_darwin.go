@@ -10,7 +10,16 @@ import "C"
 
 import (
 	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"time"
 	"unsafe"
+
+	"github.com/shirou/gopsutil/v4/process"
 )
 
 func getExePath(pid uint32) (string, error) {
@@ -26,3 +35,110 @@ func getExePath(pid uint32) (string, error) {
 	}
 	return C.GoString(buf), nil
 }
+
+// callerIdentity is a snapshot of the calling process. Without pidfds it
+// can't be pinned, so verify only re-reads it by PID.
+type callerIdentity struct {
+	pid      uint32
+	args     []string
+	exe      string
+	uid, gid uint32   // effective user and group
+	groups   []uint32 // supplementary groups of the user
+
+	lineage     []*callerIdentity // ancestors, nearest first
+	lineageErr  error
+	lineageDone bool
+}
+
+func captureCaller(pid uint32) (*callerIdentity, error) {
+	proc, err := process.NewProcess(int32(pid))
+	if err != nil {
+		return nil, err
+	}
+	args, err := proc.CmdlineSlice()
+	if err != nil {
+		return nil, err
+	}
+	exe, err := getExePath(pid)
+	if err != nil {
+		return nil, err
+	}
+	uids, err := proc.Uids()
+	if err != nil || len(uids) < 2 {
+		return nil, fmt.Errorf("reading uid of %d: %v", pid, err)
+	}
+	gids, err := proc.Gids()
+	if err != nil || len(gids) < 2 {
+		return nil, fmt.Errorf("reading gid of %d: %v", pid, err)
+	}
+	id := &callerIdentity{pid: pid, args: args, exe: exe, uid: uids[1], gid: gids[1]}
+	// Without /proc, supplementary groups come from the user's NSS membership
+	if u, err := user.LookupId(strconv.FormatUint(uint64(id.uid), 10)); err == nil {
+		groupIDs, _ := u.GroupIds()
+		for _, g := range groupIDs {
+			if n, err := strconv.ParseUint(g, 10, 32); err == nil {
+				id.groups = append(id.groups, uint32(n))
+			}
+		}
+	}
+	return id, nil
+}
+
+func captureAncestor(pid uint32) (*callerIdentity, error) {
+	return captureCaller(pid)
+}
+
+func (id *callerIdentity) exeInfo() (os.FileInfo, error) {
+	return os.Stat(id.exe)
+}
+
+func (id *callerIdentity) parentPid() (uint32, error) {
+	proc, err := process.NewProcess(int32(id.pid))
+	if err != nil {
+		return 0, err
+	}
+	ppid, err := proc.Ppid()
+	return uint32(ppid), err
+}
+
+func (id *callerIdentity) exeHash() (string, error) {
+	return HashFile(id.exe)
+}
+
+// openScript opens path relative to the caller's working directory. Without
+// /proc the directory is looked up by path, so this is best effort.
+func (id *callerIdentity) openScript(path string) (*os.File, error) {
+	if !filepath.IsAbs(path) {
+		proc, err := process.NewProcess(int32(id.pid))
+		if err != nil {
+			return nil, err
+		}
+		cwd, err := proc.Cwd()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(cwd, path)
+	}
+	return os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+}
+
+func statCtime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Ctimespec.Unix())
+}
+
+func (id *callerIdentity) verify() error {
+	current, err := captureCaller(id.pid)
+	if err != nil {
+		return fmt.Errorf("process %d exited: %w", id.pid, err)
+	}
+	if current.exe != id.exe || !slices.Equal(current.args, id.args) || current.uid != id.uid || current.gid != id.gid {
+		return fmt.Errorf("process %d changed while being checked", id.pid)
+	}
+	return nil
+}
+
+func (id *callerIdentity) Close() {
+	for _, a := range id.lineage {
+		a.Close()
+	}
+}
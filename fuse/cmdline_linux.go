@@ -3,9 +3,21 @@
 package fuse
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/shirou/gopsutil/v4/process"
+	"golang.org/x/sys/unix"
 )
 
 func getExePath(pid uint32) (string, error) {
@@ -16,3 +28,315 @@ func getExePath(pid uint32) (string, error) {
 
 	return proc.ExeWithContext(context.Background())
 }
+
+// callerIdentity pins the calling process while its access is checked: a
+// pidfd keeps the process identity, /proc/<pid> is held open so reads can't
+// switch to a reused PID, and the executable is held open by fd.
+type callerIdentity struct {
+	pid       uint32 // thread group ID of the caller
+	args      []string
+	exe       string
+	exeFile   *os.File
+	startTime string
+	uid, gid  uint32   // filesystem user and group
+	groups    []uint32 // supplementary groups
+
+	pidfd   int
+	procDir *os.File
+
+	lineage     []*callerIdentity // pinned ancestors, nearest first
+	lineageErr  error
+	lineageDone bool
+}
+
+// captureCaller snapshots the process owning thread tid. FUSE reports the
+// calling thread, which is blocked in the request while we look at it.
+func captureCaller(tid uint32) (*callerIdentity, error) {
+	return capture(tid, true)
+}
+
+// captureAncestor snapshots a process up the caller's tree. The executable
+// of a process owned by another user may be unreadable, leaving exe empty.
+func captureAncestor(pid uint32) (*callerIdentity, error) {
+	return capture(pid, false)
+}
+
+func capture(tid uint32, needExe bool) (*callerIdentity, error) {
+	tgid, err := threadGroup(tid)
+	if err != nil {
+		return nil, err
+	}
+
+	pidfd, err := unix.PidfdOpen(int(tgid), 0)
+	if err != nil {
+		return nil, fmt.Errorf("pidfd_open: %w", err)
+	}
+	id := &callerIdentity{pid: tgid, pidfd: pidfd}
+
+	if id.procDir, err = os.Open(fmt.Sprintf("/proc/%d", tgid)); err != nil {
+		id.Close()
+		return nil, err
+	}
+	// If the process is still alive, the directory we opened is its own
+	if err := id.alive(); err != nil {
+		id.Close()
+		return nil, err
+	}
+
+	if id.startTime, err = id.readStartTime(); err != nil {
+		id.Close()
+		return nil, err
+	}
+	if id.uid, id.gid, id.groups, err = id.readCreds(); err != nil {
+		id.Close()
+		return nil, err
+	}
+	if id.args, err = id.readArgs(); err != nil {
+		id.Close()
+		return nil, err
+	}
+	if id.exe, err = id.readlink("exe"); err != nil {
+		if needExe || !errors.Is(err, os.ErrPermission) {
+			id.Close()
+			return nil, err
+		}
+		return id, nil
+	}
+	if id.exeFile, err = id.openat("exe"); err != nil {
+		id.Close()
+		return nil, err
+	}
+	return id, nil
+}
+
+// threadGroup returns the process ID for a thread ID
+func threadGroup(tid uint32) (uint32, error) {
+	status, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", tid))
+	if err != nil {
+		return 0, err
+	}
+	return statusField(status, "Tgid", tid)
+}
+
+// statusField parses a numeric field of /proc/<pid>/status
+func statusField(status []byte, key string, pid uint32) (uint32, error) {
+	for line := range strings.SplitSeq(string(status), "\n") {
+		if v, ok := strings.CutPrefix(line, key+":"); ok {
+			n, err := strconv.ParseUint(strings.TrimSpace(v), 10, 32)
+			return uint32(n), err
+		}
+	}
+	return 0, fmt.Errorf("no %s in /proc/%d/status", key, pid)
+}
+
+// statusIDs parses a list of IDs from /proc/<pid>/status, such as
+// "Uid:	1000	1000	1000	1000"
+func statusIDs(status []byte, key string) ([]uint32, error) {
+	for line := range strings.SplitSeq(string(status), "\n") {
+		v, ok := strings.CutPrefix(line, key+":")
+		if !ok {
+			continue
+		}
+		var ids []uint32
+		for f := range strings.FieldsSeq(v) {
+			n, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, uint32(n))
+		}
+		return ids, nil
+	}
+	return nil, fmt.Errorf("no %s in status", key)
+}
+
+// readCreds returns the filesystem UID and GID, the IDs permission checks
+// use, and the supplementary groups
+func (id *callerIdentity) readCreds() (uid, gid uint32, groups []uint32, err error) {
+	status, err := id.readFile("status")
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	uids, err := statusIDs(status, "Uid")
+	if err != nil || len(uids) != 4 {
+		return 0, 0, nil, fmt.Errorf("malformed Uid in /proc/%d/status", id.pid)
+	}
+	gids, err := statusIDs(status, "Gid")
+	if err != nil || len(gids) != 4 {
+		return 0, 0, nil, fmt.Errorf("malformed Gid in /proc/%d/status", id.pid)
+	}
+	if groups, err = statusIDs(status, "Groups"); err != nil {
+		return 0, 0, nil, err
+	}
+	return uids[3], gids[3], groups, nil
+}
+
+// parentPid reads the current parent of the pinned process
+func (id *callerIdentity) parentPid() (uint32, error) {
+	status, err := id.readFile("status")
+	if err != nil {
+		return 0, err
+	}
+	return statusField(status, "PPid", id.pid)
+}
+
+// alive checks the process hasn't exited. Signalling another user's process
+// fails with EPERM, which still means it exists.
+func (id *callerIdentity) alive() error {
+	if err := unix.PidfdSendSignal(id.pidfd, 0, nil, 0); err != nil && err != unix.EPERM {
+		return fmt.Errorf("process %d exited: %w", id.pid, err)
+	}
+	return nil
+}
+
+func (id *callerIdentity) openat(name string) (*os.File, error) {
+	fd, err := unix.Openat(int(id.procDir.Fd()), name, unix.O_RDONLY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening /proc/%d/%s: %w", id.pid, name, err)
+	}
+	return os.NewFile(uintptr(fd), fmt.Sprintf("/proc/%d/%s", id.pid, name)), nil
+}
+
+func (id *callerIdentity) readFile(name string) ([]byte, error) {
+	f, err := id.openat(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+func (id *callerIdentity) readlink(name string) (string, error) {
+	buf := make([]byte, unix.PathMax)
+	n, err := unix.Readlinkat(int(id.procDir.Fd()), name, buf)
+	if err != nil {
+		return "", fmt.Errorf("reading /proc/%d/%s: %w", id.pid, name, err)
+	}
+	return string(buf[:n]), nil
+}
+
+func (id *callerIdentity) readArgs() ([]string, error) {
+	data, err := id.readFile("cmdline")
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimSuffix(data, []byte{0})
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return strings.Split(string(data), "\x00"), nil
+}
+
+// readStartTime returns field 22 of /proc/<pid>/stat, the start time in
+// clock ticks since boot, which tells processes sharing a PID apart
+func (id *callerIdentity) readStartTime() (string, error) {
+	data, err := id.readFile("stat")
+	if err != nil {
+		return "", err
+	}
+	// The command name in field 2 may contain spaces and parentheses
+	i := bytes.LastIndexByte(data, ')')
+	if i == -1 {
+		return "", fmt.Errorf("malformed /proc/%d/stat", id.pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return "", fmt.Errorf("malformed /proc/%d/stat", id.pid)
+	}
+	return fields[19], nil
+}
+
+// exeInfo describes the pinned executable
+func (id *callerIdentity) exeInfo() (os.FileInfo, error) {
+	return id.exeFile.Stat()
+}
+
+// exeHash hashes the pinned executable, so a binary swapped on disk after
+// the caller started is not what gets hashed
+func (id *callerIdentity) exeHash() (string, error) {
+	return fileHash(id.exeFile)
+}
+
+// openScript opens path as the caller sees it: relative paths through its
+// pinned working directory and absolute ones through its root, so a process
+// that changed directory or replaced its cwd path can't redirect the lookup.
+// Non-blocking, so a FIFO can't stall the check.
+func (id *callerIdentity) openScript(path string) (*os.File, error) {
+	name := "cwd/" + path
+	if filepath.IsAbs(path) {
+		name = "root" + path
+	}
+	fd, err := unix.Openat(int(id.procDir.Fd()), name, unix.O_RDONLY|unix.O_CLOEXEC|unix.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening script %s of %d: %w", path, id.pid, err)
+	}
+	return os.NewFile(uintptr(fd), path), nil
+}
+
+func statCtime(st *syscall.Stat_t) time.Time {
+	return time.Unix(st.Ctim.Unix())
+}
+
+// verify checks that the pinned process is still running the same program
+// with the same arguments, so a decision made on the snapshot still holds.
+func (id *callerIdentity) verify() error {
+	if err := id.alive(); err != nil {
+		return err
+	}
+	startTime, err := id.readStartTime()
+	if err != nil {
+		return err
+	}
+	if startTime != id.startTime {
+		return fmt.Errorf("process %d was replaced", id.pid)
+	}
+
+	uid, gid, groups, err := id.readCreds()
+	if err != nil {
+		return err
+	}
+	if uid != id.uid || gid != id.gid || !slices.Equal(groups, id.groups) {
+		return fmt.Errorf("process %d changed its credentials", id.pid)
+	}
+
+	if id.exeFile != nil {
+		exe, err := id.openat("exe")
+		if err != nil {
+			return err
+		}
+		defer exe.Close()
+		current, err := exe.Stat()
+		if err != nil {
+			return err
+		}
+		pinned, err := id.exeFile.Stat()
+		if err != nil {
+			return err
+		}
+		if !os.SameFile(current, pinned) {
+			return fmt.Errorf("process %d executed another program", id.pid)
+		}
+	}
+
+	args, err := id.readArgs()
+	if err != nil {
+		return err
+	}
+	if strings.Join(args, "\x00") != strings.Join(id.args, "\x00") {
+		return fmt.Errorf("process %d changed its command line", id.pid)
+	}
+	return nil
+}
+
+func (id *callerIdentity) Close() {
+	for _, a := range id.lineage {
+		a.Close()
+	}
+	if id.exeFile != nil {
+		id.exeFile.Close()
+	}
+	if id.procDir != nil {
+		id.procDir.Close()
+	}
+	unix.Close(id.pidfd)
+}
@@ -0,0 +1,244 @@
+//go:build linux
+
+package fuse
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCaptureCaller(t *testing.T) {
+	id, err := captureCaller(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+
+	if !strings.Contains(id.cmdline(), "test") || id.startTime == "" {
+		t.Errorf("unexpected identity: cmdline %q start %q", id.cmdline(), id.startTime)
+	}
+	if !id.argv0MatchesExe() {
+		t.Error("argv[0] should match the test binary")
+	}
+	if id.uid != uint32(os.Getuid()) || id.gid != uint32(os.Getgid()) {
+		t.Errorf("credentials: got uid %d gid %d", id.uid, id.gid)
+	}
+	if err := id.verify(); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+
+	// Another thread of this process resolves to the same process
+	tid := unix.Gettid()
+	other, err := captureCaller(uint32(tid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if other.pid != uint32(os.Getpid()) {
+		t.Errorf("thread %d: got pid %d", tid, other.pid)
+	}
+}
+
+func TestCaptureCallerDetectsExit(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skip("sleep unavailable:", err)
+	}
+	id, err := captureCaller(uint32(cmd.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	if err := id.verify(); err == nil {
+		t.Error("verify should fail after the process exited")
+	}
+}
+
+func TestCaptureCallerDetectsExec(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "read x; exec sleep 30")
+	stdin, _ := cmd.StdinPipe()
+	if err := cmd.Start(); err != nil {
+		t.Skip("sh unavailable:", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	id, err := captureCaller(uint32(cmd.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+	if err := id.verify(); err != nil {
+		t.Fatalf("verify before exec: %v", err)
+	}
+
+	stdin.Write([]byte("go\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for id.verify() == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("verify should fail after the process exec'd")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestAncestryRules(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	if err := cmd.Start(); err != nil {
+		t.Skip("sleep unavailable:", err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+	id, err := captureCaller(uint32(cmd.Process.Pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		rule CmdRule
+		want bool
+	}{
+		{"ancestor", CmdRule{Ancestor: self}, true},
+		{"missing ancestor", CmdRule{Ancestor: "/nonexistent"}, false},
+		{"excluded ancestor", CmdRule{NotAncestors: []string{"/nonexistent", self}}, false},
+		{"no excluded ancestor", CmdRule{NotAncestors: []string{"/nonexistent"}}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.allows(id); got != tt.want {
+			t.Errorf("%s: allows = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	lineage, _ := id.ancestors()
+	if len(lineage) == 0 || lineage[0].pid != uint32(os.Getpid()) {
+		t.Fatalf("first ancestor should be the test process, got %d ancestors", len(lineage))
+	}
+}
+
+func TestAncestorArgv0Spoofing(t *testing.T) {
+	// bash's exec -a starts sleep with a made-up argv[0], posing as sshd
+	cmd := exec.Command("bash", "-c", "exec -a /usr/sbin/sshd sh -c 'sleep 30 & echo $!; read x'")
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Skip("bash unavailable:", err)
+	}
+	defer func() {
+		stdin.Close()
+		cmd.Wait()
+	}()
+	var pid uint32
+	if _, err := fmt.Fscan(stdout, &pid); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Kill(int(pid), syscall.SIGKILL)
+
+	id, err := captureCaller(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+
+	if (CmdRule{Ancestor: "/usr/sbin/sshd"}).allows(id) {
+		t.Error("spoofed argv[0] satisfied an ancestor rule")
+	}
+	if (CmdRule{NotAncestors: []string{"/usr/sbin/sshd"}}).allows(id) {
+		t.Error("spoofed argv[0] evaded an exclusion")
+	}
+}
+
+func TestAncestryDetectsExit(t *testing.T) {
+	// sh starts sleep in the background, prints its PID and waits
+	cmd := exec.Command("sh", "-c", "sleep 30 & echo $!; read x")
+	stdin, _ := cmd.StdinPipe()
+	stdout, _ := cmd.StdoutPipe()
+	if err := cmd.Start(); err != nil {
+		t.Skip("sh unavailable:", err)
+	}
+	var pid uint32
+	if _, err := fmt.Fscan(stdout, &pid); err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Kill(int(pid), syscall.SIGKILL)
+
+	id, err := captureCaller(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+	lineage, _ := id.ancestors()
+	if len(lineage) == 0 || lineage[0].pid != uint32(cmd.Process.Pid) {
+		t.Fatal("first ancestor should be sh")
+	}
+	if err := lineage[0].verify(); err != nil {
+		t.Fatalf("verify before exit: %v", err)
+	}
+
+	stdin.Close()
+	cmd.Wait()
+	if err := lineage[0].verify(); err == nil {
+		t.Error("verify should fail after the ancestor exited")
+	}
+}
+
+func TestOpenScriptFollowsPinnedCwd(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/script.py", []byte("print(1)"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Chdir(dir)
+
+	id, err := captureCaller(uint32(os.Getpid()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer id.Close()
+
+	// Renaming the directory doesn't redirect the lookup
+	moved := dir + "-moved"
+	if err := os.Rename(dir, moved); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Rename(moved, dir)
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir)
+	if err := os.WriteFile(dir+"/script.py", []byte("evil"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(dir + "/script.py")
+
+	for _, path := range []string{"script.py", moved + "/script.py"} {
+		f, err := id.openScript(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(f)
+		f.Close()
+		if string(data) != "print(1)" {
+			t.Errorf("%s: read %q", path, data)
+		}
+	}
+}
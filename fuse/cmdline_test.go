@@ -1,9 +1,12 @@
 package fuse
 
 import (
+	"errors"
 	"os"
 	"strings"
 	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
 )
 
 func TestGetCmdline(t *testing.T) {
@@ -63,3 +66,15 @@ func TestCmdlineConstruction(t *testing.T) {
 
 	t.Logf("Successfully constructed cmdline: %s", cmdline)
 }
+
+func TestCheckUnpinned(t *testing.T) {
+	caller := &fuse.Caller{Owner: fuse.Owner{Uid: uint32(os.Getuid()), Gid: uint32(os.Getgid())}, Pid: uint32(os.Getpid())}
+
+	cmdline, _, errno := checkUnpinned("test", caller, "access", errors.New("pidfd_open: ENOSYS"))
+	if errno != 0 {
+		t.Errorf("unpinned check of current process: %v", errno)
+	}
+	if cmdline != getCmdline(caller.Pid) {
+		t.Errorf("cmdline = %q", cmdline)
+	}
+}
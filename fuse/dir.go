@@ -0,0 +1,191 @@
+package fuse
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/evict/secrets-fuse/secretmanager"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// SecretDir is a read-only directory of secrets, used for nested filenames
+// and expanded wildcards. Its children are managed by SecretRoot, so lookups
+// and listings only see what has been added.
+type SecretDir struct {
+	fs.Inode
+}
+
+func (d *SecretDir) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	out.Mode = 0500 // r-x------
+	return 0
+}
+
+func (d *SecretDir) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
+	child := d.GetChild(name)
+	if child == nil {
+		return nil, syscall.ENOENT
+	}
+	if ga, ok := child.Operations().(fs.NodeGetattrer); ok {
+		var attr fuse.AttrOut
+		if errno := ga.Getattr(ctx, nil, &attr); errno == 0 {
+			out.Attr = attr.Attr
+		}
+	}
+	return child, 0
+}
+
+func (d *SecretDir) Readdir(ctx context.Context) (fs.DirStream, syscall.Errno) {
+	children := d.Children()
+	entries := make([]fuse.DirEntry, 0, len(children))
+	for name, child := range children {
+		entries = append(entries, fuse.DirEntry{Name: name, Mode: child.Mode(), Ino: child.StableAttr().Ino})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return fs.NewListDirStream(entries), 0
+}
+
+// splitFilename splits a configured filename such as "certs/tls.key" into
+// path components, rejecting ones that would leave the mount.
+func splitFilename(filename string) ([]string, error) {
+	var parts []string
+	for _, part := range strings.Split(filename, "/") {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			return nil, fmt.Errorf("filename %q must not contain ..", filename)
+		}
+		parts = append(parts, part)
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty filename %q", filename)
+	}
+	return parts, nil
+}
+
+// mkdirAll returns the directory at parts below parent, creating read-only
+// SecretDirs where needed.
+func mkdirAll(ctx context.Context, parent *fs.Inode, parts []string) (*fs.Inode, error) {
+	for i, name := range parts {
+		child := parent.GetChild(name)
+		if child == nil {
+			child = parent.NewPersistentInode(ctx, &SecretDir{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+			parent.AddChild(name, child, false)
+		} else if _, ok := child.Operations().(*SecretDir); !ok {
+			return nil, fmt.Errorf("%s is not a directory", strings.Join(parts[:i+1], "/"))
+		}
+		parent = child
+	}
+	return parent, nil
+}
+
+// walkDir returns the node at parts below parent, or nil
+func walkDir(parent *fs.Inode, parts []string) *fs.Inode {
+	for _, name := range parts {
+		if parent = parent.GetChild(name); parent == nil {
+			return nil
+		}
+	}
+	return parent
+}
+
+// dirName is the directory an expanded wildcard is mounted under: the custom
+// filename, or the reference up to the first wildcard ("op://Vault/*/password"
+// mounts at "Vault").
+func (s *SecretConfig) dirName() string {
+	if s.Filename != "" {
+		return s.Filename
+	}
+	name := referenceToFilename(secretmanager.WildcardPrefix(s.Reference))
+	if name == "." {
+		return secretmanager.Scheme(s.Reference)
+	}
+	return name
+}
+
+// sanitizeName makes a provider title usable as a single path component
+func sanitizeName(name string) string {
+	name = strings.ReplaceAll(name, "/", "_")
+	if name == "" || name == "." || name == ".." {
+		return "_" + name
+	}
+	return name
+}
+
+// expandWildcard fills dir with one SecretFile per match of secret's pattern.
+// Files whose reference is unchanged are kept, so read counts survive a
+// refresh; entries that no longer match are removed.
+func (r *SecretRoot) expandWildcard(ctx context.Context, dir *fs.Inode, secret SecretConfig) error {
+	matches, err := secretmanager.Expand(ctx, r.manager, secret.Reference)
+	if err != nil {
+		return err
+	}
+
+	keep := make(map[*fs.Inode]bool)
+matches:
+	for _, match := range matches {
+		if len(match.Path) == 0 {
+			continue
+		}
+		parent := dir
+		for _, name := range match.Path[:len(match.Path)-1] {
+			name = sanitizeName(name)
+			child := parent.GetChild(name)
+			if child != nil {
+				if _, ok := child.Operations().(*SecretDir); !ok {
+					if keep[child] {
+						log.Printf("Secret %s: %s is already a file, skipping", match.Reference, name)
+						continue matches
+					}
+					parent.RmChild(name)
+					child = nil
+				}
+			}
+			if child == nil {
+				child = parent.NewPersistentInode(ctx, &SecretDir{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+				parent.AddChild(name, child, false)
+			}
+			keep[child] = true
+			parent = child
+		}
+
+		name := sanitizeName(match.Path[len(match.Path)-1])
+		if child := parent.GetChild(name); child != nil {
+			if keep[child] {
+				log.Printf("Secret %s: duplicate name %s, skipping", match.Reference, name)
+				continue
+			}
+			if sf, ok := child.Operations().(*SecretFile); ok && sf.reference == match.Reference {
+				keep[child] = true
+				continue
+			}
+			parent.RmChild(name)
+		}
+		sf, err := r.newSecretFile(secret, match.Reference)
+		if err != nil {
+			return err
+		}
+		child := parent.NewPersistentInode(ctx, sf, fs.StableAttr{Mode: fuse.S_IFREG})
+		parent.AddChild(name, child, false)
+		keep[child] = true
+	}
+
+	pruneDir(dir, keep)
+	return nil
+}
+
+// pruneDir removes every descendant of dir not in keep
+func pruneDir(dir *fs.Inode, keep map[*fs.Inode]bool) {
+	for name, child := range dir.Children() {
+		if !keep[child] {
+			dir.RmChild(name)
+			continue
+		}
+		pruneDir(child, keep)
+	}
+}
@@ -0,0 +1,176 @@
+//go:build linux
+
+package fuse
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+	"golang.org/x/sys/unix"
+)
+
+// Gate enforces allowlists with fanotify permission events. The kernel holds
+// the opener blocked in open(2) until the gate answers, so the process can't
+// exec or exit between the check and the open.
+type Gate struct {
+	file  *os.File
+	mount string
+	root  *SecretRoot
+}
+
+// StartGate marks the mount for FAN_OPEN_PERM events and answers them with
+// the allowlist of the opened secret. It needs CAP_SYS_ADMIN; without it the
+// error wraps EPERM and the FUSE-level checks are the only enforcement.
+func StartGate(mountPoint string, root *SecretRoot) (*Gate, error) {
+	// Event fds resolve to the real path, so symlinks in mountPoint must be too
+	mount, err := filepath.Abs(mountPoint)
+	if err != nil {
+		return nil, err
+	}
+	if mount, err = filepath.EvalSymlinks(mount); err != nil {
+		return nil, err
+	}
+	fd, err := unix.FanotifyInit(unix.FAN_CLASS_CONTENT|unix.FAN_CLOEXEC|unix.FAN_NONBLOCK, unix.O_RDONLY|unix.O_CLOEXEC|unix.O_LARGEFILE)
+	if err != nil {
+		return nil, fmt.Errorf("fanotify_init: %w", err)
+	}
+	if err := unix.FanotifyMark(fd, unix.FAN_MARK_ADD|unix.FAN_MARK_MOUNT, unix.FAN_OPEN_PERM, unix.AT_FDCWD, mount); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("fanotify_mark %s: %w", mount, err)
+	}
+
+	g := &Gate{file: os.NewFile(uintptr(fd), "fanotify"), mount: mount, root: root}
+	go g.run()
+	return g, nil
+}
+
+// Close stops the gate. The kernel allows opens still waiting for an answer.
+func (g *Gate) Close() error {
+	return g.file.Close()
+}
+
+// gateThreads holds the threads reading fanotify events. Reading an event
+// makes the kernel open the file on that thread, which FUSE then sees as an
+// open by the daemon itself.
+var gateThreads sync.Map
+
+// isGateOpen reports whether caller is a gate receiving an event fd
+func isGateOpen(caller *fuse.Caller) bool {
+	if caller == nil {
+		return false
+	}
+	_, ok := gateThreads.Load(caller.Pid)
+	return ok
+}
+
+func (g *Gate) run() {
+	// Unanswered opens are allowed once the fd is closed
+	defer g.file.Close()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	tid := uint32(unix.Gettid())
+	gateThreads.Store(tid, true)
+	defer gateThreads.Delete(tid)
+
+	buf := make([]byte, 4096)
+	backoff := time.Duration(0)
+	for {
+		n, err := g.file.Read(buf)
+		if errors.Is(err, os.ErrClosed) {
+			return
+		}
+		if err != nil {
+			// The kernel denies an event it failed to report. Back off so a
+			// persistent error, e.g. EMFILE, doesn't spin.
+			log.Printf("fanotify: %v", err)
+			backoff = min(max(2*backoff, 10*time.Millisecond), time.Second)
+			time.Sleep(backoff)
+			continue
+		}
+		backoff = 0
+		for off := 0; off+int(unsafe.Sizeof(unix.FanotifyEventMetadata{})) <= n; {
+			meta := *(*unix.FanotifyEventMetadata)(unsafe.Pointer(&buf[off]))
+			if meta.Event_len == 0 || meta.Vers != unix.FANOTIFY_METADATA_VERSION {
+				log.Printf("fanotify: unexpected event metadata version %d", meta.Vers)
+				return
+			}
+			off += int(meta.Event_len)
+			if meta.Fd < 0 {
+				continue // queue overflow
+			}
+			go g.handle(meta)
+		}
+	}
+}
+
+func (g *Gate) handle(meta unix.FanotifyEventMetadata) {
+	defer unix.Close(int(meta.Fd))
+
+	name, policy, err := g.target(meta.Fd)
+	allow := true
+	switch {
+	case meta.Pid == int32(os.Getpid()):
+		// The daemon's own opens are checked by FUSE
+	case err != nil:
+		log.Printf("Secret %s: open denied by fanotify (%v) [pid=%d]", name, err, meta.Pid)
+		allow = false
+	default:
+		if cmdline, err := g.check(uint32(meta.Pid), policy); err != nil {
+			log.Printf("Secret %s: open denied by fanotify (%v) [pid=%d cmd=%q]", name, err, meta.Pid, cmdline)
+			allow = false
+		}
+	}
+
+	resp := unix.FanotifyResponse{Fd: meta.Fd, Response: unix.FAN_ALLOW}
+	if !allow {
+		resp.Response = unix.FAN_DENY
+	}
+	if _, err := g.file.Write(unsafe.Slice((*byte)(unsafe.Pointer(&resp)), unsafe.Sizeof(resp))); err != nil && !errors.Is(err, os.ErrClosed) {
+		log.Printf("fanotify: answering pid %d: %v", meta.Pid, err)
+	}
+}
+
+// target names the file behind an event fd and returns its policy. A path
+// that can't be mapped back into the mount is an error rather than an empty
+// policy, so the open is denied.
+func (g *Gate) target(fd int32) (string, Policy, error) {
+	path, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd))
+	if err != nil {
+		return "?", Policy{}, err
+	}
+	if strings.HasSuffix(path, " (deleted)") {
+		return path, Policy{}, errors.New("file was removed")
+	}
+	rel, err := filepath.Rel(g.mount, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return path, Policy{}, fmt.Errorf("%s is outside %s", path, g.mount)
+	}
+	if rel == "." {
+		return path, Policy{}, nil
+	}
+	name, policy := g.root.policyFor(rel)
+	return name, policy, nil
+}
+
+// check applies the policy to the blocked opener
+func (g *Gate) check(pid uint32, policy Policy) (cmdline string, err error) {
+	if policy.empty() {
+		return "", nil
+	}
+	id, err := captureCaller(pid)
+	if err != nil {
+		return "", fmt.Errorf("cannot identify caller: %w", err)
+	}
+	defer id.Close()
+	return id.cmdline(), authorize(id, policy)
+}
@@ -0,0 +1,114 @@
+//go:build linux && privileged
+
+package fuse
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Run with: go test -tags privileged ./fuse (as root)
+func TestGateDecidesOpens(t *testing.T) {
+	cat, err := exec.LookPath("cat")
+	if err != nil {
+		t.Skip("cat not found")
+	}
+	mountPoint := t.TempDir()
+
+	manager := NewMockSecretManager()
+	manager.secrets["op://test/item/allowed"] = "allowed-value"
+	manager.secrets["op://test/item/denied"] = "denied-value"
+	secrets := []SecretConfig{
+		{Reference: "op://test/item/allowed", Filename: "allowed.txt", MaxReads: 1, AllowedCmds: []CmdRule{{Cmd: cat}}},
+		{Reference: "op://test/item/denied", Filename: "dir/denied.txt", AllowedCmds: []CmdRule{{Cmd: "/nonexistent"}}},
+	}
+	root := NewSecretRoot(manager, secrets, 0)
+
+	zero := time.Duration(0)
+	server, err := fs.Mount(mountPoint, root, &fs.Options{
+		MountOptions:    fuse.MountOptions{DirectMount: true},
+		AttrTimeout:     &zero,
+		EntryTimeout:    &zero,
+		NegativeTimeout: &zero,
+	})
+	if err != nil {
+		t.Skipf("mount: %v", err)
+	}
+	defer server.Unmount()
+
+	// The gate is started through a symlink, which events never show
+	link := filepath.Join(t.TempDir(), "link")
+	if err := os.Symlink(mountPoint, link); err != nil {
+		t.Fatal(err)
+	}
+	gate, err := StartGate(link, root)
+	if err != nil {
+		t.Skipf("fanotify: %v", err)
+	}
+	defer gate.Close()
+
+	// Receiving the event opens the file for the gate too, which must not
+	// count as a read
+	out, err := exec.Command(cat, filepath.Join(mountPoint, "allowed.txt")).CombinedOutput()
+	if err != nil || string(out) != "allowed-value" {
+		t.Errorf("allowed open: %q, %v", out, err)
+	}
+
+	// The gate answers before FUSE sees the open, with EPERM rather than
+	// the EACCES of the FUSE-level check
+	out, err = exec.Command(cat, filepath.Join(mountPoint, "dir/denied.txt")).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "Operation not permitted") {
+		t.Errorf("denied open: %q, %v", out, err)
+	}
+
+	// The daemon's own opens skip the gate but are still checked by FUSE
+	if _, err := os.ReadFile(filepath.Join(mountPoint, "dir/denied.txt")); !errors.Is(err, syscall.EACCES) {
+		t.Errorf("own open: got %v, want EACCES", err)
+	}
+}
+
+func TestGateTargetOutsideMount(t *testing.T) {
+	mountPoint := t.TempDir()
+	g := &Gate{mount: mountPoint, root: NewSecretRoot(NewMockSecretManager(), nil, 0)}
+
+	outside, err := os.Open(os.Args[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer outside.Close()
+	if _, _, err := g.target(int32(outside.Fd())); err == nil {
+		t.Error("expected a file outside the mount to be rejected")
+	}
+
+	path := filepath.Join(mountPoint, "gone")
+	if err := os.WriteFile(path, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	removed, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer removed.Close()
+	os.Remove(path)
+	if _, _, err := g.target(int32(removed.Fd())); err == nil {
+		t.Error("expected a removed file to be rejected")
+	}
+
+	root, err := os.Open(mountPoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer root.Close()
+	if _, _, err := g.target(int32(root.Fd())); err != nil {
+		t.Errorf("mount root: %v", err)
+	}
+}
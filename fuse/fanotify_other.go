@@ -0,0 +1,24 @@
+//go:build !linux
+
+package fuse
+
+import (
+	"errors"
+
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// Gate is only available on Linux
+type Gate struct{}
+
+func StartGate(mountPoint string, root *SecretRoot) (*Gate, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (g *Gate) Close() error {
+	return nil
+}
+
+func isGateOpen(caller *fuse.Caller) bool {
+	return false
+}
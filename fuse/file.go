@@ -4,7 +4,6 @@ import (
 	"context"
 	"fmt"
 	"log"
-	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -17,10 +16,11 @@ import (
 
 type SecretFile struct {
 	fs.Inode
-	manager     secretmanager.SecretManager
-	reference   string
-	allowedCmds []string
-	writable    bool
+	manager   secretmanager.SecretManager
+	reference string
+	policy    Policy
+	writable  bool
+	transform Transform
 
 	mu        sync.Mutex
 	content   []byte
@@ -31,50 +31,66 @@ type SecretFile struct {
 	writeSize uint64
 }
 
-func NewSecretFile(manager secretmanager.SecretManager, reference string, maxReads int32, allowedCmds []string, writable bool) *SecretFile {
+func NewSecretFile(manager secretmanager.SecretManager, reference string, maxReads int32, policy Policy, writable bool) *SecretFile {
 	return &SecretFile{
-		manager:     manager,
-		reference:   reference,
-		maxReads:    maxReads,
-		allowedCmds: allowedCmds,
-		writable:    writable,
+		manager:   manager,
+		reference: reference,
+		maxReads:  maxReads,
+		policy:    policy,
+		writable:  writable,
 	}
 }
 
-func (f *SecretFile) isAllowed(cmdline string) bool {
-	if len(f.allowedCmds) == 0 {
-		return true // no allowlist = allow all
-	}
-	for _, pattern := range f.allowedCmds {
-		if matched, _ := filepath.Match(pattern, cmdline); matched {
-			return true
-		}
-		// Also try matching just the first arg (executable name)
-		if matched, _ := filepath.Match(pattern, firstArg(cmdline)); matched {
-			return true
-		}
-	}
-	return false
+func (f *SecretFile) checkAccess(caller *fuse.Caller, op string) (cmdline string, callerInfo string, errno syscall.Errno) {
+	return checkAccess(f.reference, f.policy, caller, op)
 }
 
-func (f *SecretFile) checkAccess(caller *fuse.Caller, op string) (cmdline string, callerInfo string, errno syscall.Errno) {
+// checkAccess verifies the calling process against policy, logging
+// denials under name. The caller is pinned while the policy is evaluated and
+// denied if it exited or exec'd before the decision was made.
+func checkAccess(name string, policy Policy, caller *fuse.Caller, op string) (cmdline string, callerInfo string, errno syscall.Errno) {
 	if caller == nil {
 		return "", "unknown", 0
 	}
 
-	cmdline = getCmdline(caller.Pid)
+	id, err := captureCaller(caller.Pid)
+	if err != nil {
+		if policy.empty() {
+			return checkUnpinned(name, caller, op, err)
+		}
+		callerInfo = fmt.Sprintf("uid=%d gid=%d pid=%d", caller.Uid, caller.Gid, caller.Pid)
+		log.Printf("Secret %s: %s denied (cannot identify caller: %v) [%s]", name, op, err, callerInfo)
+		return "", callerInfo, syscall.EACCES
+	}
+	defer id.Close()
+
+	cmdline = id.cmdline()
 	callerInfo = fmt.Sprintf("uid=%d gid=%d pid=%d cmd=%q", caller.Uid, caller.Gid, caller.Pid, cmdline)
 
-	if !validateCmdlineExe(caller.Pid) {
-		log.Printf("Secret %s: %s denied (cmdline/exe mismatch - possible spoofing) [%s]", f.reference, op, callerInfo)
+	if err := authorize(id, policy); err != nil {
+		log.Printf("Secret %s: %s denied (%v) [%s]", name, op, err, callerInfo)
 		return cmdline, callerInfo, syscall.EACCES
 	}
 
-	if !f.isAllowed(cmdline) {
-		log.Printf("Secret %s: %s denied (not in allowlist) [%s]", f.reference, op, callerInfo)
+	return cmdline, callerInfo, 0
+}
+
+var unpinnedWarning sync.Once
+
+// checkUnpinned falls back to checking the caller by PID when it can't be
+// pinned, e.g. on kernels without pidfd_open. Only secrets without rules take
+// this path, as their decision doesn't depend on who the caller is.
+func checkUnpinned(name string, caller *fuse.Caller, op string, pinErr error) (cmdline string, callerInfo string, errno syscall.Errno) {
+	unpinnedWarning.Do(func() {
+		log.Printf("Warning: cannot pin callers (%v); checking secrets without allowlists by PID only", pinErr)
+	})
+
+	cmdline = getCmdline(caller.Pid)
+	callerInfo = fmt.Sprintf("uid=%d gid=%d pid=%d cmd=%q", caller.Uid, caller.Gid, caller.Pid, cmdline)
+	if !validateCmdlineExe(caller.Pid) {
+		log.Printf("Secret %s: %s denied (cmdline/exe mismatch - possible spoofing) [%s]", name, op, callerInfo)
 		return cmdline, callerInfo, syscall.EACCES
 	}
-
 	return cmdline, callerInfo, 0
 }
 
@@ -87,11 +103,23 @@ func firstArg(cmdline string) string {
 	return cmdline
 }
 
+// fetch resolves the secret and applies its transform pipeline
+func (f *SecretFile) fetch(ctx context.Context) ([]byte, error) {
+	val, err := f.manager.Resolve(ctx, f.reference)
+	if err != nil {
+		return nil, err
+	}
+	return f.transform.Apply([]byte(val))
+}
+
 func (f *SecretFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
 	caller, _ := fuse.FromContext(ctx)
+	if isGateOpen(caller) {
+		return nil, fuse.FOPEN_DIRECT_IO, 0 // fanotify event fd, never read
+	}
 	_, callerInfo, errno := f.checkAccess(caller, "access")
 	if errno != 0 {
 		return nil, 0, errno
@@ -113,7 +141,7 @@ func (f *SecretFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uin
 		}
 	}
 
-	val, err := f.manager.Resolve(ctx, f.reference)
+	val, err := f.fetch(ctx)
 	if err != nil {
 		log.Printf("Failed to resolve %s: %v [%s]", f.reference, err, callerInfo)
 		return nil, 0, syscall.ENOENT
@@ -123,7 +151,7 @@ func (f *SecretFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uin
 		f.content = []byte{}
 		f.dirty = true
 	} else {
-		f.content = []byte(val)
+		f.content = val
 	}
 
 	if !isWrite {
@@ -147,12 +175,12 @@ func (f *SecretFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, of
 
 	// Re-fetch if content was invalidated (after a write)
 	if f.content == nil {
-		val, err := f.manager.Resolve(ctx, f.reference)
+		val, err := f.fetch(ctx)
 		if err != nil {
 			log.Printf("Secret %s: failed to re-read: %v", f.reference, err)
 			return nil, syscall.EIO
 		}
-		f.content = []byte(val)
+		f.content = val
 		log.Printf("Secret %s: re-fetched %d bytes", f.reference, len(f.content))
 	}
 
@@ -179,6 +207,35 @@ func (f *SecretFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.At
 	return 0
 }
 
+// checkWrite checks that the secret is writable and the caller may write it.
+// Must be called with f.mu held.
+func (f *SecretFile) checkWrite(caller *fuse.Caller) syscall.Errno {
+	_, callerInfo, errno := f.checkAccess(caller, "write")
+	if errno != 0 {
+		return errno
+	}
+	if !f.writable {
+		log.Printf("Secret %s: write denied (not writable) [%s]", f.reference, callerInfo)
+		return syscall.EACCES
+	}
+	return 0
+}
+
+// replace stores content as the new value, for editors that save by renaming
+// a scratch file over the secret
+func (f *SecretFile) replace(ctx context.Context, content []byte) syscall.Errno {
+	caller, _ := fuse.FromContext(ctx)
+	f.mu.Lock()
+	if errno := f.checkWrite(caller); errno != 0 {
+		f.mu.Unlock()
+		return errno
+	}
+	f.content = content
+	f.dirty = true
+	f.mu.Unlock()
+	return f.Flush(ctx, nil)
+}
+
 func (f *SecretFile) Write(ctx context.Context, fh fs.FileHandle, data []byte, off int64) (uint32, syscall.Errno) {
 	f.mu.Lock()
 	defer f.mu.Unlock()
@@ -212,6 +269,11 @@ func (f *SecretFile) Setattr(ctx context.Context, fh fs.FileHandle, in *fuse.Set
 	defer f.mu.Unlock()
 
 	if sz, ok := in.GetSize(); ok {
+		// Truncating marks the file dirty, so it is checked like a write
+		caller, _ := fuse.FromContext(ctx)
+		if errno := f.checkWrite(caller); errno != 0 {
+			return errno
+		}
 		f.writeSize = sz
 		if sz < uint64(len(f.content)) {
 			f.content = f.content[:sz]
@@ -245,7 +307,20 @@ func (f *SecretFile) Flush(ctx context.Context, fh fs.FileHandle) syscall.Errno
 		callerInfo = fmt.Sprintf("uid=%d gid=%d pid=%d cmd=%q", caller.Uid, caller.Gid, caller.Pid, cmdline)
 	}
 
-	err := f.manager.Write(ctx, f.reference, string(f.content))
+	value := f.content
+	if len(f.transform) > 0 {
+		orig, err := f.manager.Resolve(ctx, f.reference)
+		if err != nil {
+			log.Printf("Secret %s: failed to read current value for transform: %v [%s]", f.reference, err, callerInfo)
+			return syscall.EIO
+		}
+		if value, err = f.transform.Invert([]byte(orig), f.content); err != nil {
+			log.Printf("Secret %s: write rejected (transform can't be reversed): %v [%s]", f.reference, err, callerInfo)
+			return syscall.EIO
+		}
+	}
+
+	err := f.manager.Write(ctx, f.reference, string(value))
 	if err != nil {
 		log.Printf("Secret %s: failed to write back: %v [%s]", f.reference, err, callerInfo)
 		return syscall.EIO
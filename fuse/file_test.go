@@ -4,9 +4,13 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/evict/secrets-fuse/secretmanager/secretmanagertest"
 	"github.com/hanwen/go-fuse/v2/fs"
 	"github.com/hanwen/go-fuse/v2/fuse"
 )
@@ -46,6 +50,10 @@ func (m *MockSecretManager) Name() string {
 	return "mock"
 }
 
+func TestMockSecretManagerConformance(t *testing.T) {
+	secretmanagertest.Run(t, NewMockSecretManager(), "op://test/item/field", "op://test/item/other")
+}
+
 func TestWriteThenRead(t *testing.T) {
 	// Create temp mount point
 	mountPoint, err := os.MkdirTemp("", "secrets-fuse-test")
@@ -206,3 +214,98 @@ func TestWriteViaRename(t *testing.T) {
 		t.Errorf("read after rename: got %q, want %q", content, newContent)
 	}
 }
+
+// childNames lists the entries under path, which is relative to root
+func childNames(root *fs.Inode, path ...string) []string {
+	dir := root
+	for _, name := range path {
+		if dir = dir.GetChild(name); dir == nil {
+			return nil
+		}
+	}
+	var names []string
+	for name := range dir.Children() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestWildcardExpansion(t *testing.T) {
+	mock := NewMockSecretManager()
+	mock.secrets["k8s://prod/db/password"] = "a"
+	mock.secrets["k8s://prod/api/password"] = "b"
+	mock.secrets["k8s://prod/api/user"] = "c"
+	mock.secrets["k8s://other/x"] = "d"
+
+	root := NewSecretRoot(mock, []SecretConfig{
+		{Reference: "k8s://prod/*/password"},
+		{Reference: "k8s://prod/api/*", Filename: "api"},
+	}, 0)
+	fs.NewNodeFS(root, &fs.Options{})
+
+	if got, want := childNames(&root.Inode), []string{"api", "prod"}; !slices.Equal(got, want) {
+		t.Errorf("root: got %v, want %v", got, want)
+	}
+	if got, want := childNames(&root.Inode, "prod"), []string{"api", "db"}; !slices.Equal(got, want) {
+		t.Errorf("prod: got %v, want %v", got, want)
+	}
+	if got, want := childNames(&root.Inode, "api"), []string{"password", "user"}; !slices.Equal(got, want) {
+		t.Errorf("api: got %v, want %v", got, want)
+	}
+	file := root.GetChild("prod").GetChild("db").GetChild("password")
+	if sf, ok := file.Operations().(*SecretFile); !ok || sf.reference != "k8s://prod/db/password" {
+		t.Fatalf("unexpected node %v", file.Operations())
+	}
+
+	delete(mock.secrets, "k8s://prod/db/password")
+	mock.secrets["k8s://prod/cache/password"] = "e"
+	if err := root.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := childNames(&root.Inode, "prod"), []string{"api", "cache"}; !slices.Equal(got, want) {
+		t.Errorf("prod after refresh: got %v, want %v", got, want)
+	}
+	if root.GetChild("prod").GetChild("api").GetChild("password") == nil {
+		t.Error("unchanged match should be kept")
+	}
+}
+
+func TestNestedFilenames(t *testing.T) {
+	mock := NewMockSecretManager()
+	root := NewSecretRoot(mock, []SecretConfig{
+		{Reference: "op://v/tls/crt", Filename: "certs/tls.crt"},
+		{Reference: "op://v/tls/key", Filename: "certs/tls.key"},
+		{Reference: "op://v/db/password", Filename: "app/db/password"},
+		{Reference: "op://v/flat/field"},
+		{Reference: "op://v/bad/field", Filename: "../escape"},
+		{Reference: "op://v/clash/field", Filename: "certs/tls.crt/x"},
+		{Reference: "op://v/clash/dir", Filename: "certs"},
+	}, 0)
+	fs.NewNodeFS(root, &fs.Options{})
+
+	if got, want := childNames(&root.Inode), []string{"app", "certs", "v_flat_field"}; !slices.Equal(got, want) {
+		t.Errorf("root: got %v, want %v", got, want)
+	}
+	if _, ok := root.GetChild("certs").Operations().(*SecretDir); !ok {
+		t.Error("certs directory was replaced by a file")
+	}
+	if got, want := childNames(&root.Inode, "certs"), []string{"tls.crt", "tls.key"}; !slices.Equal(got, want) {
+		t.Errorf("certs: got %v, want %v", got, want)
+	}
+
+	db := root.GetChild("app").GetChild("db")
+	stream, errno := db.Operations().(*SecretDir).Readdir(context.Background())
+	if errno != 0 {
+		t.Fatal(errno)
+	}
+	entry, _ := stream.Next()
+	if entry.Name != "password" || entry.Mode != fuse.S_IFREG || stream.HasNext() {
+		t.Errorf("unexpected readdir entry %+v", entry)
+	}
+
+	var out fuse.EntryOut
+	if _, errno := db.Operations().(*SecretDir).Lookup(context.Background(), "missing", &out); errno != syscall.ENOENT {
+		t.Errorf("lookup of missing entry: got %v", errno)
+	}
+}
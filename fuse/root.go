@@ -2,7 +2,9 @@ package fuse
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"strings"
@@ -15,12 +17,30 @@ import (
 
 type SecretConfig struct {
 	Reference   string
-	Filename    string   // optional custom filename
-	MaxReads    int32    // 0 = unlimited
-	AllowedCmds []string // glob patterns for allowed command lines
-	SymlinkTo   string   // optional path to create a symlink to the secret
-	Writable    bool     // allow writing back to password manager
-	OPAccount   string   // optional: override 1Password account for this secret
+	Filename    string    // optional custom filename
+	MaxReads    int32     // 0 = unlimited
+	AllowedCmds []CmdRule // allowed callers
+	AllowedUIDs []uint32  // optional: users allowed to open the secret
+	AllowedGIDs []uint32  // optional: groups (primary or supplementary) allowed to open it
+	SymlinkTo   string    // optional path to create a symlink to the secret
+	Writable    bool      // allow writing back to password manager
+	OPAccount   string    // optional: override 1Password account for this secret
+	Template    string    // optional: render the file from a template instead of Reference
+	Transform   []string  // optional: pipeline applied to resolved values, e.g. "jsonpath:.key"
+}
+
+func (s *SecretConfig) policy() Policy {
+	return Policy{Cmds: s.AllowedCmds, UIDs: s.AllowedUIDs, GIDs: s.AllowedGIDs}
+}
+
+// References returns the references the secret reads: its own, or those
+// named in its template.
+func (s *SecretConfig) References() []string {
+	if s.Template == "" {
+		return []string{s.Reference}
+	}
+	refs, _ := TemplateReferences(s.Template)
+	return refs
 }
 
 func (s *SecretConfig) CreateSymlink(mountPoint string) (string, error) {
@@ -58,22 +78,36 @@ func (s *SecretConfig) CreateSymlink(mountPoint string) (string, error) {
 
 type SecretRoot struct {
 	fs.Inode
-	manager  secretmanager.SecretManager
-	secrets  []SecretConfig
-	maxReads int32 // default max reads for all secrets
+	manager   secretmanager.SecretManager
+	secrets   []SecretConfig
+	maxReads  int32 // default max reads for all secrets
+	wildcards []wildcardDir
+}
+
+// wildcardDir is the directory an expanded wildcard reference is mounted at
+type wildcardDir struct {
+	secret SecretConfig
+	dir    *fs.Inode
 }
 
 // EphemeralDir is an in-memory directory that supports creating files/subdirs
 type EphemeralDir struct {
 	fs.Inode
+	root *SecretRoot
 }
 
 func (d *EphemeralDir) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	child := d.NewInode(ctx, &EphemeralDir{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+	if errno := d.root.mayCreate(ctx, name); errno != 0 {
+		return nil, errno
+	}
+	child := d.NewInode(ctx, &EphemeralDir{root: d.root}, fs.StableAttr{Mode: fuse.S_IFDIR})
 	return child, 0
 }
 
 func (d *EphemeralDir) Create(ctx context.Context, name string, flags uint32, mode uint32, out *fuse.EntryOut) (inode *fs.Inode, fh fs.FileHandle, fuseFlags uint32, errno syscall.Errno) {
+	if errno := d.root.mayCreate(ctx, name); errno != 0 {
+		return nil, nil, 0, errno
+	}
 	child := d.NewInode(ctx, &EphemeralFile{}, fs.StableAttr{Mode: fuse.S_IFREG})
 	return child, nil, fuse.FOPEN_DIRECT_IO, 0
 }
@@ -103,21 +137,14 @@ func (d *EphemeralDir) Rename(ctx context.Context, name string, newParent fs.Ino
 		return syscall.ENOTSUP
 	}
 
-	// Destination is SecretRoot with a SecretFile
-	if destRoot, ok := newParent.(*SecretRoot); ok {
-		destChild := destRoot.GetChild(newName)
-		if destChild != nil {
-			if sf, ok := destChild.Operations().(*SecretFile); ok {
-				sf.mu.Lock()
-				sf.content = content
-				sf.dirty = true
-				sf.mu.Unlock()
-				if err := sf.Flush(ctx, nil); err != 0 {
-					return err
-				}
-				d.RmChild(name)
-				return 0
+	// Destination is a SecretFile in the root or a nested SecretDir
+	if destChild := newParent.EmbeddedInode().GetChild(newName); destChild != nil {
+		if sf, ok := destChild.Operations().(*SecretFile); ok {
+			if err := sf.replace(ctx, content); err != 0 {
+				return err
 			}
+			d.RmChild(name)
+			return 0
 		}
 	}
 
@@ -191,10 +218,36 @@ func NewSecretRoot(manager secretmanager.SecretManager, secrets []SecretConfig,
 }
 
 func (r *SecretRoot) Mkdir(ctx context.Context, name string, mode uint32, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
-	child := r.NewInode(ctx, &EphemeralDir{}, fs.StableAttr{Mode: fuse.S_IFDIR})
+	if errno := r.mayCreate(ctx, name); errno != 0 {
+		return nil, errno
+	}
+	child := r.NewInode(ctx, &EphemeralDir{root: r}, fs.StableAttr{Mode: fuse.S_IFDIR})
 	return child, 0
 }
 
+// mayCreate lets a caller create scratch files, which editors save through,
+// only if it passes the user rules of some secret. With allow_other, other
+// users can't fill the daemon's memory or stage files to rename over secrets.
+func (r *SecretRoot) mayCreate(ctx context.Context, name string) syscall.Errno {
+	caller, ok := fuse.FromContext(ctx)
+	if !ok {
+		return 0
+	}
+	// FUSE reports the filesystem IDs; supplementary groups need the process
+	id := &callerIdentity{uid: caller.Uid, gid: caller.Gid}
+	if pinned, err := captureCaller(caller.Pid); err == nil {
+		defer pinned.Close()
+		id = pinned
+	}
+	for _, secret := range r.secrets {
+		if secret.policy().allowsUser(id) {
+			return 0
+		}
+	}
+	log.Printf("Create %s denied (no secret allows uid %d / gid %d) [pid=%d]", name, id.uid, id.gid, caller.Pid)
+	return syscall.EACCES
+}
+
 func (r *SecretRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut) (*fs.Inode, syscall.Errno) {
 	// First check if child exists in the tree
 	if child := r.GetChild(name); child != nil {
@@ -203,17 +256,19 @@ func (r *SecretRoot) Lookup(ctx context.Context, name string, out *fuse.EntryOut
 
 	// Check if this is a configured secret that needs to be recreated
 	for _, secret := range r.secrets {
+		if secret.Template != "" || secretmanager.IsWildcard(secret.Reference) {
+			continue // templates and wildcard directories are persistent
+		}
 		filename := secret.Filename
 		if filename == "" {
 			filename = referenceToFilename(secret.Reference)
 		}
 		if filename == name {
 			// Recreate the SecretFile inode
-			maxReads := secret.MaxReads
-			if maxReads == 0 {
-				maxReads = r.maxReads
+			sf, err := r.newSecretFile(secret, secret.Reference)
+			if err != nil {
+				return nil, syscall.ENOENT
 			}
-			sf := NewSecretFile(r.manager, secret.Reference, maxReads, secret.AllowedCmds, secret.Writable)
 			child := r.NewInode(ctx, sf, fs.StableAttr{Mode: fuse.S_IFREG})
 			r.AddChild(name, child, true)
 			return child, 0
@@ -241,21 +296,14 @@ func (r *SecretRoot) Rename(ctx context.Context, name string, newParent fs.Inode
 		return syscall.ENOTSUP
 	}
 
-	// Find destination - check if it's a SecretFile
-	if destRoot, ok := newParent.(*SecretRoot); ok {
-		destChild := destRoot.GetChild(newName)
-		if destChild != nil {
-			if sf, ok := destChild.Operations().(*SecretFile); ok {
-				sf.mu.Lock()
-				sf.content = content
-				sf.dirty = true
-				sf.mu.Unlock()
-				if err := sf.Flush(ctx, nil); err != 0 {
-					return err
-				}
-				r.RmChild(name)
-				return 0
+	// Find destination - check if it's a SecretFile, possibly in a SecretDir
+	if destChild := newParent.EmbeddedInode().GetChild(newName); destChild != nil {
+		if sf, ok := destChild.Operations().(*SecretFile); ok {
+			if err := sf.replace(ctx, content); err != 0 {
+				return err
 			}
+			r.RmChild(name)
+			return 0
 		}
 	}
 
@@ -264,25 +312,160 @@ func (r *SecretRoot) Rename(ctx context.Context, name string, newParent fs.Inode
 
 func (r *SecretRoot) OnAdd(ctx context.Context) {
 	for _, secret := range r.secrets {
+		if secret.Template != "" {
+			r.addTemplate(ctx, secret)
+			continue
+		}
+		if secretmanager.IsWildcard(secret.Reference) {
+			r.addWildcard(ctx, secret)
+			continue
+		}
+
 		filename := secret.Filename
 		if filename == "" {
 			filename = referenceToFilename(secret.Reference)
 		}
+		parts, err := splitFilename(filename)
+		if err != nil {
+			log.Printf("Secret %s: %v", secret.Reference, err)
+			continue
+		}
+
+		sf, err := r.newSecretFile(secret, secret.Reference)
+		if err != nil {
+			log.Printf("Secret %s: %v", secret.Reference, err)
+			continue
+		}
+
+		if len(parts) == 1 {
+			// Don't replace a directory or file placed by an earlier secret
+			if r.GetChild(parts[0]) != nil {
+				log.Printf("Secret %s: %s already exists", secret.Reference, parts[0])
+				continue
+			}
+			child := r.NewInode(ctx, sf, fs.StableAttr{Mode: fuse.S_IFREG})
+			r.AddChild(parts[0], child, false)
+			continue
+		}
+
+		// Nested files live in persistent directories, as only the root
+		// recreates forgotten children in Lookup
+		if err := r.addPersistent(ctx, parts, sf); err != nil {
+			log.Printf("Secret %s: %v", secret.Reference, err)
+		}
+	}
+}
+
+// newSecretFile creates the file for reference with secret's settings
+func (r *SecretRoot) newSecretFile(secret SecretConfig, reference string) (*SecretFile, error) {
+	transform, err := ParseTransform(secret.Transform)
+	if err != nil {
+		return nil, err
+	}
+	maxReads := secret.MaxReads
+	if maxReads == 0 {
+		maxReads = r.maxReads
+	}
+	sf := NewSecretFile(r.manager, reference, maxReads, secret.policy(), secret.Writable)
+	sf.transform = transform
+	return sf, nil
+}
 
-		maxReads := secret.MaxReads
-		if maxReads == 0 {
-			maxReads = r.maxReads
+// addPersistent places node at parts below the root, creating directories
+func (r *SecretRoot) addPersistent(ctx context.Context, parts []string, node fs.InodeEmbedder) error {
+	parent, err := mkdirAll(ctx, &r.Inode, parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+	name := parts[len(parts)-1]
+	if parent.GetChild(name) != nil {
+		return fmt.Errorf("%s already exists", strings.Join(parts, "/"))
+	}
+	parent.AddChild(name, parent.NewPersistentInode(ctx, node, fs.StableAttr{Mode: fuse.S_IFREG}), false)
+	return nil
+}
+
+// addTemplate creates a TemplateFile for a template secret
+func (r *SecretRoot) addTemplate(ctx context.Context, secret SecretConfig) {
+	parts, err := splitFilename(secret.Filename)
+	if err != nil {
+		log.Printf("Template %s: %v", secret.Filename, err)
+		return
+	}
+	tmpl, err := ParseTemplate(secret.Filename, secret.Template)
+	if err != nil {
+		log.Printf("Template %s: %v", secret.Filename, err)
+		return
+	}
+
+	maxReads := secret.MaxReads
+	if maxReads == 0 {
+		maxReads = r.maxReads
+	}
+	tf := NewTemplateFile(r.manager, secret.Filename, tmpl, maxReads, secret.policy())
+	if err := r.addPersistent(ctx, parts, tf); err != nil {
+		log.Printf("Template %s: %v", secret.Filename, err)
+	}
+}
+
+// addWildcard creates the directory for a wildcard reference and fills it
+func (r *SecretRoot) addWildcard(ctx context.Context, secret SecretConfig) {
+	parts, err := splitFilename(secret.dirName())
+	if err != nil {
+		log.Printf("Secret %s: %v", secret.Reference, err)
+		return
+	}
+	if walkDir(&r.Inode, parts) != nil {
+		log.Printf("Secret %s: %s already exists", secret.Reference, secret.dirName())
+		return
+	}
+	dir, err := mkdirAll(ctx, &r.Inode, parts)
+	if err != nil {
+		log.Printf("Secret %s: %v", secret.Reference, err)
+		return
+	}
+	r.wildcards = append(r.wildcards, wildcardDir{secret: secret, dir: dir})
+
+	if err := r.expandWildcard(ctx, dir, secret); err != nil {
+		log.Printf("Failed to expand %s: %v", secret.Reference, err)
+	}
+}
+
+// Refresh re-expands wildcard references, adding newly matching secrets and
+// removing ones that have gone away.
+func (r *SecretRoot) Refresh(ctx context.Context) error {
+	var errs []error
+	for _, w := range r.wildcards {
+		if err := r.expandWildcard(ctx, w.dir, w.secret); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", w.secret.Reference, err))
 		}
+	}
+	return errors.Join(errs...)
+}
 
-		child := r.NewInode(ctx, NewSecretFile(r.manager, secret.Reference, maxReads, secret.AllowedCmds, secret.Writable),
-			fs.StableAttr{Mode: fuse.S_IFREG})
-		r.AddChild(filename, child, true)
+// policyFor returns the name and policy of the file at path, relative to the
+// mount. Directories and files created by writers have no policy.
+func (r *SecretRoot) policyFor(path string) (string, Policy) {
+	node := walkDir(r.EmbeddedInode(), strings.Split(filepath.ToSlash(path), "/"))
+	if node == nil {
+		return path, Policy{}
+	}
+	switch f := node.Operations().(type) {
+	case *SecretFile:
+		return f.reference, f.policy
+	case *TemplateFile:
+		return f.name, f.policy
 	}
+	return path, Policy{}
 }
 
-// referenceToFilename converts "op://Vault/Item/Field" to "Vault_Item_Field"
+// referenceToFilename converts "op://Vault/Item/Field" to "Vault_Item_Field".
+// Any scheme is dropped, so "file:///srv/.env#KEY" becomes "srv_.env#KEY".
 func referenceToFilename(ref string) string {
-	ref = strings.TrimPrefix(ref, "op://")
+	if _, rest, ok := strings.Cut(ref, "://"); ok {
+		ref = rest
+	}
+	ref = strings.TrimLeft(ref, "/")
 	ref = strings.ReplaceAll(ref, "/", "_")
 
 	return filepath.Clean(ref)
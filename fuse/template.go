@@ -0,0 +1,226 @@
+package fuse
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/evict/secrets-fuse/secretmanager"
+	"github.com/hanwen/go-fuse/v2/fs"
+	"github.com/hanwen/go-fuse/v2/fuse"
+)
+
+// templateFuncs are available in every template. "secret" is replaced with a
+// resolver for each render.
+var templateFuncs = template.FuncMap{
+	"secret": func(reference string) (string, error) {
+		return "", fmt.Errorf("secret used outside of a render")
+	},
+	"json":   jsonQuote,
+	"yaml":   yamlQuote,
+	"shell":  shellQuote,
+	"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+}
+
+// jsonQuote returns s as a JSON string literal, quotes included
+func jsonQuote(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// yamlQuote returns s as a YAML double-quoted scalar. JSON string literals
+// are valid YAML, and quoting keeps values like "yes" or "0755" strings.
+func yamlQuote(s string) string {
+	return jsonQuote(s)
+}
+
+// shellQuote returns s single-quoted for POSIX shells and dotenv files
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// ParseTemplate parses a template secret's text
+func ParseTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+// TemplateReferences returns the references passed as string literals to
+// "secret" in text, so their providers can be set up before mounting.
+func TemplateReferences(text string) ([]string, error) {
+	t, err := ParseTemplate("", text)
+	if err != nil {
+		return nil, err
+	}
+	var refs []string
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil {
+			collectReferences(tmpl.Tree.Root, &refs)
+		}
+	}
+	return refs, nil
+}
+
+func collectReferences(node parse.Node, refs *[]string) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			collectReferences(child, refs)
+		}
+	case *parse.ActionNode:
+		collectReferences(n.Pipe, refs)
+	case *parse.IfNode:
+		collectBranch(&n.BranchNode, refs)
+	case *parse.RangeNode:
+		collectBranch(&n.BranchNode, refs)
+	case *parse.WithNode:
+		collectBranch(&n.BranchNode, refs)
+	case *parse.TemplateNode:
+		collectReferences(n.Pipe, refs)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectReferences(cmd, refs)
+		}
+	case *parse.CommandNode:
+		if len(n.Args) == 2 {
+			ident, isIdent := n.Args[0].(*parse.IdentifierNode)
+			str, isString := n.Args[1].(*parse.StringNode)
+			if isIdent && isString && ident.Ident == "secret" && !slices.Contains(*refs, str.Text) {
+				*refs = append(*refs, str.Text)
+			}
+		}
+		for _, arg := range n.Args {
+			collectReferences(arg, refs)
+		}
+	}
+}
+
+func collectBranch(n *parse.BranchNode, refs *[]string) {
+	collectReferences(n.Pipe, refs)
+	collectReferences(n.List, refs)
+	collectReferences(n.ElseList, refs)
+}
+
+// TemplateFile is a read-only file rendered from a template that combines
+// several secrets. Every referenced secret is resolved on each Open.
+type TemplateFile struct {
+	fs.Inode
+	manager secretmanager.SecretManager
+	name    string
+	tmpl    *template.Template
+	policy  Policy
+
+	mu        sync.Mutex
+	content   []byte
+	readCount atomic.Int32
+	maxReads  int32
+}
+
+func NewTemplateFile(manager secretmanager.SecretManager, name string, tmpl *template.Template, maxReads int32, policy Policy) *TemplateFile {
+	return &TemplateFile{
+		manager:  manager,
+		name:     name,
+		tmpl:     tmpl,
+		maxReads: maxReads,
+		policy:   policy,
+	}
+}
+
+// render executes the template, resolving secrets through the manager
+func (f *TemplateFile) render(ctx context.Context) ([]byte, error) {
+	t, err := f.tmpl.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{
+		"secret": func(reference string) (string, error) {
+			return f.manager.Resolve(ctx, reference)
+		},
+	})
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, nil); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (f *TemplateFile) Open(ctx context.Context, flags uint32) (fs.FileHandle, uint32, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	caller, _ := fuse.FromContext(ctx)
+	if isGateOpen(caller) {
+		return nil, fuse.FOPEN_DIRECT_IO, 0 // fanotify event fd, never read
+	}
+	_, callerInfo, errno := checkAccess(f.name, f.policy, caller, "access")
+	if errno != 0 {
+		return nil, 0, errno
+	}
+
+	if flags&(syscall.O_WRONLY|syscall.O_RDWR) != 0 {
+		log.Printf("Secret %s: write denied (templates are read-only) [%s]", f.name, callerInfo)
+		return nil, 0, syscall.EACCES
+	}
+
+	if f.maxReads > 0 && f.readCount.Load() >= f.maxReads {
+		log.Printf("Secret %s: read limit (%d) exhausted [%s]", f.name, f.maxReads, callerInfo)
+		return nil, 0, syscall.EACCES
+	}
+
+	content, err := f.render(ctx)
+	if err != nil {
+		log.Printf("Failed to render %s: %v [%s]", f.name, err, callerInfo)
+		return nil, 0, syscall.EIO
+	}
+	f.content = content
+	f.readCount.Add(1)
+
+	if f.maxReads > 0 {
+		log.Printf("Secret %s: access granted (read %d/%d) [%s]", f.name, f.readCount.Load(), f.maxReads, callerInfo)
+	} else {
+		log.Printf("Secret %s: access granted [%s]", f.name, callerInfo)
+	}
+
+	return nil, fuse.FOPEN_DIRECT_IO, 0
+}
+
+func (f *TemplateFile) Read(ctx context.Context, fh fs.FileHandle, dest []byte, off int64) (fuse.ReadResult, syscall.Errno) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if int(off) >= len(f.content) {
+		return fuse.ReadResultData(nil), 0
+	}
+	end := min(int(off)+len(dest), len(f.content))
+	return fuse.ReadResultData(f.content[off:end]), 0
+}
+
+func (f *TemplateFile) Getattr(ctx context.Context, fh fs.FileHandle, out *fuse.AttrOut) syscall.Errno {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out.Size = uint64(len(f.content))
+	out.Mode = 0400 // r--------
+	out.Mtime = uint64(time.Now().Unix())
+	return 0
+}
@@ -0,0 +1,84 @@
+package fuse
+
+import (
+	"context"
+	"slices"
+	"syscall"
+	"testing"
+
+	"github.com/hanwen/go-fuse/v2/fs"
+)
+
+func TestTemplateReferences(t *testing.T) {
+	refs, err := TemplateReferences(`{{ define "creds" }}{{ secret "op://v/db/user" }}{{ end -}}
+user={{ template "creds" }}
+{{ if secret "op://v/db/password" }}password={{ secret "op://v/db/password" | shell }}{{ end }}
+host={{ with secret "vault://kv/db#host" }}{{ . }}{{ end }}
+{{ $ref := "op://dynamic/x/y" }}{{ secret $ref }}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"op://v/db/password", "vault://kv/db#host", "op://v/db/user"}
+	slices.Sort(refs)
+	slices.Sort(want)
+	if !slices.Equal(refs, want) {
+		t.Errorf("got %v, want %v", refs, want)
+	}
+
+	if _, err := TemplateReferences(`{{ secret "x" `); err == nil {
+		t.Error("expected parse error")
+	}
+}
+
+func TestTemplateQuoting(t *testing.T) {
+	for _, tt := range []struct {
+		fn   func(string) string
+		in   string
+		want string
+	}{
+		{jsonQuote, `p"a<s>s\`, `"p\"a<s>s\\"`},
+		{yamlQuote, "yes", `"yes"`},
+		{yamlQuote, "a\nb", `"a\nb"`},
+		{shellQuote, "it's $HOME", `'it'\''s $HOME'`},
+	} {
+		if got := tt.fn(tt.in); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTemplateFile(t *testing.T) {
+	mock := NewMockSecretManager()
+	mock.secrets["op://v/db/user"] = "app"
+	mock.secrets["op://v/db/password"] = `p@ss"word`
+
+	tmpl, err := ParseTemplate("config.json", `{"user": {{ secret "op://v/db/user" | json }}, "password": {{ secret "op://v/db/password" | json }}, "auth": "{{ print (secret "op://v/db/user") ":x" | base64 }}"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := NewSecretRoot(mock, []SecretConfig{{Filename: "docker/config.json", Template: `{{ secret "op://v/db/user" }}`}}, 0)
+	fs.NewNodeFS(root, &fs.Options{})
+	if _, ok := root.GetChild("docker").GetChild("config.json").Operations().(*TemplateFile); !ok {
+		t.Error("template should be mounted at docker/config.json")
+	}
+
+	ctx := context.Background()
+	f := NewTemplateFile(mock, "config.json", tmpl, 1, Policy{})
+	if _, _, errno := f.Open(ctx, syscall.O_RDONLY); errno != 0 {
+		t.Fatalf("open: %v", errno)
+	}
+	dest := make([]byte, 256)
+	res, _ := f.Read(ctx, nil, dest, 0)
+	got, _ := res.Bytes(dest)
+	want := `{"user": "app", "password": "p@ss\"word", "auth": "YXBwOng="}`
+	if string(got) != want {
+		t.Errorf("rendered %s, want %s", got, want)
+	}
+
+	if _, _, errno := f.Open(ctx, syscall.O_RDONLY); errno != syscall.EACCES {
+		t.Errorf("second open should exceed read limit, got %v", errno)
+	}
+	if _, _, errno := NewTemplateFile(mock, "x", tmpl, 0, Policy{}).Open(ctx, syscall.O_WRONLY); errno != syscall.EACCES {
+		t.Errorf("write open should be denied, got %v", errno)
+	}
+}
@@ -0,0 +1,182 @@
+package fuse
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/evict/secrets-fuse/secretmanager"
+)
+
+// transformStep is one stage of a secret's transform pipeline. invert maps
+// edited output back to input, given the input the output was derived from.
+type transformStep struct {
+	name   string
+	apply  func(in []byte) ([]byte, error)
+	invert func(orig, out []byte) ([]byte, error)
+}
+
+// Transform is a pipeline applied to secret values after they are resolved,
+// and inverted before edited content is written back.
+type Transform []transformStep
+
+// ParseTransform builds a pipeline from steps such as "jsonpath:.db.password",
+// "base64-decode", "base64-encode", "hex-decode", "hex-encode", "trim" and
+// "pem:1" or "pem:CERTIFICATE".
+func ParseTransform(steps []string) (Transform, error) {
+	var t Transform
+	for _, step := range steps {
+		name, arg, _ := strings.Cut(step, ":")
+		s := transformStep{name: step}
+		switch name {
+		case "jsonpath":
+			if arg == "" {
+				return nil, fmt.Errorf("transform %q: missing key path", step)
+			}
+			path := strings.TrimPrefix(arg, "$")
+			s.apply = func(in []byte) ([]byte, error) {
+				v, _, err := secretmanager.ExtractKey(in, path)
+				return []byte(v), err
+			}
+			s.invert = func(orig, out []byte) ([]byte, error) {
+				if _, scalar, err := secretmanager.ExtractKey(orig, path); err == nil && !scalar {
+					return nil, fmt.Errorf("%s selects a map or list, which can't be written back", path)
+				}
+				return secretmanager.SetKey(orig, path, string(out))
+			}
+		case "base64-decode":
+			s.apply, s.invert = decodeBase64, encodeInverse(encodeBase64)
+		case "base64-encode":
+			s.apply, s.invert = encodeBase64, encodeInverse(decodeBase64)
+		case "hex-decode":
+			s.apply, s.invert = decodeHex, encodeInverse(encodeHex)
+		case "hex-encode":
+			s.apply, s.invert = encodeHex, encodeInverse(decodeHex)
+		case "trim":
+			s.apply = func(in []byte) ([]byte, error) {
+				return bytes.TrimRight(in, "\r\n"), nil
+			}
+			s.invert = func(orig, out []byte) ([]byte, error) {
+				suffix := orig[len(bytes.TrimRight(orig, "\r\n")):]
+				return slices.Concat(bytes.TrimRight(out, "\r\n"), suffix), nil
+			}
+		case "pem":
+			if arg == "" {
+				return nil, fmt.Errorf("transform %q: missing block index or type", step)
+			}
+			s.apply = func(in []byte) ([]byte, error) {
+				start, end, err := findPEMBlock(in, arg)
+				if err != nil {
+					return nil, err
+				}
+				return in[start:end], nil
+			}
+			s.invert = func(orig, out []byte) ([]byte, error) {
+				if block, rest := pem.Decode(out); block == nil || len(bytes.TrimSpace(rest)) > 0 {
+					return nil, fmt.Errorf("content must be exactly one PEM block")
+				}
+				start, end, err := findPEMBlock(orig, arg)
+				if err != nil {
+					return nil, err
+				}
+				var newline []byte
+				if !bytes.HasSuffix(out, []byte("\n")) && bytes.HasSuffix(orig[:end], []byte("\n")) {
+					newline = []byte("\n")
+				}
+				return slices.Concat(orig[:start], out, newline, orig[end:]), nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown transform %q", step)
+		}
+		t = append(t, s)
+	}
+	return t, nil
+}
+
+func (t Transform) Apply(in []byte) ([]byte, error) {
+	for _, s := range t {
+		out, err := s.apply(in)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		in = out
+	}
+	return in, nil
+}
+
+// Invert turns edited output back into a value to store, given the stored
+// value orig. It fails when the edit can't be expressed in the source format.
+func (t Transform) Invert(orig, out []byte) ([]byte, error) {
+	// Intermediate inputs of every step, derived from the stored value
+	inputs := make([][]byte, len(t))
+	in := orig
+	for i, s := range t {
+		inputs[i] = in
+		next, err := s.apply(in)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.name, err)
+		}
+		in = next
+	}
+
+	for i := len(t) - 1; i >= 0; i-- {
+		prev, err := t[i].invert(inputs[i], out)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", t[i].name, err)
+		}
+		out = prev
+	}
+	return out, nil
+}
+
+// encodeInverse adapts an encoding as the inverse of its decoding step
+func encodeInverse(encode func([]byte) ([]byte, error)) func(orig, out []byte) ([]byte, error) {
+	return func(orig, out []byte) ([]byte, error) {
+		return encode(out)
+	}
+}
+
+func decodeBase64(in []byte) ([]byte, error) {
+	return base64.StdEncoding.DecodeString(string(bytes.TrimSpace(in)))
+}
+
+func encodeBase64(in []byte) ([]byte, error) {
+	return []byte(base64.StdEncoding.EncodeToString(in)), nil
+}
+
+func decodeHex(in []byte) ([]byte, error) {
+	return hex.DecodeString(string(bytes.TrimSpace(in)))
+}
+
+func encodeHex(in []byte) ([]byte, error) {
+	return []byte(hex.EncodeToString(in)), nil
+}
+
+// findPEMBlock returns the byte range of the PEM block selected by index or
+// type, including its trailing newline.
+func findPEMBlock(data []byte, selector string) (start, end int, err error) {
+	index, byIndex := -1, false
+	if n, err := strconv.Atoi(selector); err == nil {
+		index, byIndex = n, true
+	}
+
+	offset := 0
+	for i := 0; ; i++ {
+		rest := data[offset:]
+		block, remaining := pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		blockStart := offset + bytes.Index(rest, []byte("-----BEGIN"))
+		offset = len(data) - len(remaining)
+		if (byIndex && i == index) || (!byIndex && block.Type == selector) {
+			return blockStart, offset, nil
+		}
+	}
+	return 0, 0, fmt.Errorf("PEM block %s not found", selector)
+}
@@ -2,11 +2,18 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -17,16 +24,160 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+type VaultConfig struct {
+	Address      string `yaml:"address"`
+	Namespace    string `yaml:"namespace"`
+	Token        string `yaml:"token"`
+	TokenFile    string `yaml:"token_file"`
+	RoleID       string `yaml:"role_id"`
+	SecretID     string `yaml:"secret_id"`
+	SecretIDFile string `yaml:"secret_id_file"`
+	AppRoleMount string `yaml:"approle_mount"`
+	KVVersion    int    `yaml:"kv_version"`
+}
+
+type OPConnectConfig struct {
+	Host      string `yaml:"host"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+type OPServiceAccountConfig struct {
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+type PassConfig struct {
+	StoreDir  string `yaml:"store_dir"`
+	GPGBinary string `yaml:"gpg"`
+}
+
+type KDBXConfig struct {
+	Path         string `yaml:"path"`
+	PasswordFile string `yaml:"password_file"`
+	PasswordEnv  string `yaml:"password_env"`
+	KeyFile      string `yaml:"key_file"`
+}
+
+type SOPSConfig struct {
+	Binary     string `yaml:"binary"`
+	AgeKeyFile string `yaml:"age_key_file"`
+	BaseDir    string `yaml:"base_dir"`
+}
+
+type AgeConfig struct {
+	IdentityFile string   `yaml:"identity_file"`
+	Recipients   []string `yaml:"recipients"`
+	BaseDir      string   `yaml:"base_dir"`
+}
+
+type AWSConfig struct {
+	Region         string `yaml:"region"`
+	Profile        string `yaml:"profile"`
+	Endpoint       string `yaml:"endpoint"`
+	SecretsPrefix  string `yaml:"secrets_prefix"`
+	ParametersPath string `yaml:"parameters_path"`
+}
+
+type GCPSecretManagerConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+type AzureKeyVaultConfig struct {
+	Endpoint  string `yaml:"endpoint"`
+	Token     string `yaml:"token"`
+	TokenFile string `yaml:"token_file"`
+}
+
+type BitwardenConfig struct {
+	Server           string `yaml:"server"`
+	ClientID         string `yaml:"client_id"`
+	ClientSecret     string `yaml:"client_secret"`
+	ClientSecretFile string `yaml:"client_secret_file"`
+	PasswordFile     string `yaml:"password_file"`
+	PasswordEnv      string `yaml:"password_env"`
+}
+
+type FileConfig struct {
+	BaseDir string `yaml:"base_dir"`
+}
+
+type KubernetesConfig struct {
+	Kubeconfig    string `yaml:"kubeconfig"`
+	Context       string `yaml:"context"`
+	LabelSelector string `yaml:"label_selector"`
+}
+
+type SecretServiceConfig struct {
+	BusAddress string `yaml:"bus_address"`
+}
+
+type PluginConfig struct {
+	Scheme  string            `yaml:"scheme"`
+	Command string            `yaml:"command"`
+	Args    []string          `yaml:"args"`
+	Env     map[string]string `yaml:"env"`
+	Timeout time.Duration     `yaml:"timeout"`
+}
+
+type CacheConfig struct {
+	Keyring string        `yaml:"keyring"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+// AllowedCmd is an allowed_cmds entry: a plain glob pattern, or a mapping
+// that also pins the SHA-256 of the executable and interpreter script, or
+// constrains the caller's ancestor processes.
+type AllowedCmd struct {
+	Cmd          string   `yaml:"cmd"`
+	SHA256       string   `yaml:"sha256"`
+	ScriptSHA256 string   `yaml:"script_sha256"`
+	Ancestor     string   `yaml:"ancestor"`
+	NotAncestors []string `yaml:"not_ancestors"`
+}
+
+func (a *AllowedCmd) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		a.Cmd = node.Value
+		return nil
+	}
+	type plain AllowedCmd
+	return node.Decode((*plain)(a))
+}
+
 type Config struct {
-	OPAccount string `yaml:"op_account"`
-	Secrets   []struct {
-		Reference   string   `yaml:"reference"`
-		Filename    string   `yaml:"filename"`
-		MaxReads    int32    `yaml:"max_reads"`
-		AllowedCmds []string `yaml:"allowed_cmds"`
-		SymlinkTo   string   `yaml:"symlink_to"`
-		Writable    bool     `yaml:"writable"`
-		OPAccount   string   `yaml:"op_account"`
+	OPAccount        string                 `yaml:"op_account"`
+	OPServiceAccount OPServiceAccountConfig `yaml:"op_service_account"`
+	OPConnect        OPConnectConfig        `yaml:"op_connect"`
+	Vault            VaultConfig            `yaml:"vault"`
+	Pass             PassConfig             `yaml:"pass"`
+	KDBX             KDBXConfig             `yaml:"kdbx"`
+	SOPS             SOPSConfig             `yaml:"sops"`
+	Age              AgeConfig              `yaml:"age"`
+	AWS              AWSConfig              `yaml:"aws"`
+	GCPSecretManager GCPSecretManagerConfig `yaml:"gcpsm"`
+	AzureKeyVault    AzureKeyVaultConfig    `yaml:"azkv"`
+	Bitwarden        BitwardenConfig        `yaml:"bitwarden"`
+	File             FileConfig             `yaml:"file"`
+	Kubernetes       KubernetesConfig       `yaml:"kubernetes"`
+	SecretService    SecretServiceConfig    `yaml:"secretservice"`
+	Plugins          []PluginConfig         `yaml:"plugins"`
+	Cache            *CacheConfig           `yaml:"cache"`
+	Secrets          []struct {
+		Reference    string       `yaml:"reference"`
+		Filename     string       `yaml:"filename"`
+		MaxReads     int32        `yaml:"max_reads"`
+		AllowedCmds  []AllowedCmd `yaml:"allowed_cmds"`
+		AllowedUIDs  []uint32     `yaml:"allowed_uids"`
+		AllowedGIDs  []uint32     `yaml:"allowed_gids"`
+		AllowedUsers []string     `yaml:"allowed_users"`
+		SymlinkTo    string       `yaml:"symlink_to"`
+		Writable     bool         `yaml:"writable"`
+		OPAccount    string       `yaml:"op_account"`
+		Template     string       `yaml:"template"`
+		Transform    []string     `yaml:"transform"`
 	} `yaml:"secrets"`
 }
 
@@ -57,11 +208,152 @@ func resolveConfigPath(explicit string) string {
 	return "config.yaml"
 }
 
+// newRouter initializes one provider per reference scheme used in the config
+func newRouter(ctx context.Context, cfg *Config, secrets []secretfuse.SecretConfig) (*secretmanager.Router, error) {
+	refs := make(map[string][]string)
+	opAccounts := make(map[string]string)
+	for _, s := range secrets {
+		for _, ref := range s.References() {
+			scheme := secretmanager.Scheme(ref)
+			refs[scheme] = append(refs[scheme], ref)
+			if s.OPAccount != "" {
+				opAccounts[ref] = s.OPAccount
+			}
+		}
+	}
+
+	plugins := make(map[string]secretmanager.PluginConfig)
+	for _, p := range cfg.Plugins {
+		plugins[p.Scheme] = secretmanager.PluginConfig{Command: p.Command, Args: p.Args, Env: p.Env, Timeout: p.Timeout}
+	}
+
+	router := secretmanager.NewRouter()
+	for scheme, schemeRefs := range refs {
+		var (
+			m   secretmanager.SecretManager
+			err error
+		)
+		switch pluginCfg, isPlugin := plugins[scheme]; {
+		case isPlugin:
+			// Plugins take precedence so built-in schemes can be overridden
+			m, err = secretmanager.NewPluginManager(ctx, schemeRefs, pluginCfg)
+		case scheme == "op":
+			if cfg.OPConnect.Host != "" || os.Getenv("OP_CONNECT_HOST") != "" {
+				// Connect serves a single server's vaults, so per-secret accounts can't apply
+				if len(opAccounts) > 0 {
+					return nil, fmt.Errorf("op_account on a secret is not supported with 1Password Connect")
+				}
+				m, err = secretmanager.NewOnePasswordConnectManager(ctx, schemeRefs, secretmanager.OnePasswordConnectConfig(cfg.OPConnect))
+				break
+			}
+			// Uses desktop app auth via OP_ACCOUNT or config file, otherwise a service account
+			// Priority: env var > config file
+			account := os.Getenv("OP_ACCOUNT")
+			if account == "" {
+				account = cfg.OPAccount
+			}
+			m, err = secretmanager.NewOnePasswordManager(ctx, schemeRefs, secretmanager.OnePasswordConfig{
+				Account:                 account,
+				Accounts:                opAccounts,
+				ServiceAccountToken:     cfg.OPServiceAccount.Token,
+				ServiceAccountTokenFile: cfg.OPServiceAccount.TokenFile,
+			})
+		case scheme == "vault":
+			m, err = secretmanager.NewVaultManager(ctx, schemeRefs, secretmanager.VaultConfig(cfg.Vault))
+		case scheme == "pass":
+			m, err = secretmanager.NewPassManager(ctx, secretmanager.PassConfig(cfg.Pass))
+		case scheme == "kdbx":
+			m, err = secretmanager.NewKDBXManager(ctx, secretmanager.KDBXConfig(cfg.KDBX))
+		case scheme == "sops":
+			m, err = secretmanager.NewSOPSManager(ctx, schemeRefs, secretmanager.SOPSConfig(cfg.SOPS))
+		case scheme == "age":
+			m, err = secretmanager.NewAgeManager(ctx, schemeRefs, secretmanager.AgeConfig(cfg.Age))
+		case scheme == "keyring":
+			m, err = secretmanager.NewKeyringManager(ctx, schemeRefs)
+		case scheme == "aws-sm":
+			m, err = secretmanager.NewAWSSecretsManager(ctx, schemeRefs, secretmanager.AWSConfig(cfg.AWS))
+		case scheme == "ssm":
+			m, err = secretmanager.NewSSMManager(ctx, schemeRefs, secretmanager.AWSConfig(cfg.AWS))
+		case scheme == "gcpsm":
+			m, err = secretmanager.NewGCPSecretManager(ctx, schemeRefs, secretmanager.GCPSecretManagerConfig(cfg.GCPSecretManager))
+		case scheme == "azkv":
+			m, err = secretmanager.NewAzureKeyVaultManager(ctx, schemeRefs, secretmanager.AzureKeyVaultConfig(cfg.AzureKeyVault))
+		case scheme == "bw":
+			m, err = secretmanager.NewBitwardenManager(ctx, schemeRefs, secretmanager.BitwardenConfig(cfg.Bitwarden))
+		case scheme == "env":
+			m, err = secretmanager.NewEnvManager(ctx, schemeRefs)
+		case scheme == "file":
+			m, err = secretmanager.NewFileManager(ctx, schemeRefs, secretmanager.FileConfig(cfg.File))
+		case scheme == "k8s":
+			m, err = secretmanager.NewKubernetesManager(ctx, schemeRefs, secretmanager.KubernetesConfig(cfg.Kubernetes))
+		case scheme == "secretservice":
+			m, err = secretmanager.NewSecretServiceManager(ctx, schemeRefs, secretmanager.SecretServiceConfig(cfg.SecretService))
+		default:
+			return nil, fmt.Errorf("unsupported reference scheme %q in %s", scheme, schemeRefs[0])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("initializing %s provider: %w", scheme, err)
+		}
+		if err := router.Register(scheme, m); err != nil {
+			return nil, err
+		}
+	}
+	return router, nil
+}
+
+// printHashEntry prints an allowed_cmds entry pinning binary, and optionally
+// the script it interprets, by SHA-256
+func printHashEntry(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf("usage: %s hash <binary> [script]", os.Args[0])
+	}
+	binary, err := exec.LookPath(args[0])
+	if err != nil {
+		return err
+	}
+	if binary, err = filepath.Abs(binary); err != nil {
+		return err
+	}
+	sum, err := secretfuse.HashFile(binary)
+	if err != nil {
+		return err
+	}
+
+	cmd := binary
+	var scriptSum string
+	if len(args) == 2 {
+		script, err := filepath.Abs(args[1])
+		if err != nil {
+			return err
+		}
+		if scriptSum, err = secretfuse.HashFile(script); err != nil {
+			return err
+		}
+		cmd += " " + script
+	}
+
+	fmt.Printf("- cmd: %q\n", cmd)
+	fmt.Printf("  sha256: %s\n", sum)
+	if scriptSum != "" {
+		fmt.Printf("  script_sha256: %s\n", scriptSum)
+	}
+	return nil
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "hash" {
+		if err := printHashEntry(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	mountPoint := flag.String("mount", "/tmp/secrets-mount", "Mount point for secrets filesystem")
 	configPath := flag.String("config", "", "Path to secrets configuration file")
 	maxReads := flag.Int("max-reads", 0, "Maximum number of reads per secret (0 = unlimited)")
 	debug := flag.Bool("debug", false, "Enable FUSE debug logging")
+	allowOther := flag.Bool("allow-other", false, "Let other users access the mount (secrets without user rules stay private to the daemon's user)")
+	useFanotify := flag.Bool("fanotify", false, "Also enforce allowlists with fanotify permission events (Linux, needs CAP_SYS_ADMIN)")
 	flag.Parse()
 
 	cfgPath := resolveConfigPath(*configPath)
@@ -71,38 +363,90 @@ func main() {
 	}
 
 	secrets := make([]secretfuse.SecretConfig, len(cfg.Secrets))
+	var private []string
 	for i, s := range cfg.Secrets {
 		maxR := s.MaxReads
 		if maxR == 0 {
 			maxR = int32(*maxReads)
 		}
+		if s.Template != "" {
+			if s.Reference != "" || s.Filename == "" {
+				log.Fatalf("Template secret %q: needs a filename and no reference", s.Filename)
+			}
+			if s.Writable {
+				log.Fatalf("Template secret %s: templates are read-only", s.Filename)
+			}
+			if _, err := secretfuse.TemplateReferences(s.Template); err != nil {
+				log.Fatalf("Template secret %s: %v", s.Filename, err)
+			}
+		}
+		if _, err := secretfuse.ParseTransform(s.Transform); err != nil {
+			log.Fatalf("Secret %s: %v", s.Reference, err)
+		}
+		if s.Template != "" && len(s.Transform) > 0 {
+			log.Fatalf("Template secret %s: transforms apply to references, not templates", s.Filename)
+		}
+		allowed := make([]secretfuse.CmdRule, len(s.AllowedCmds))
+		for j, a := range s.AllowedCmds {
+			if a.Cmd == "" && a.SHA256 == "" && a.ScriptSHA256 == "" && a.Ancestor == "" && len(a.NotAncestors) == 0 {
+				log.Fatalf("Secret %s: empty allowed_cmds entry", s.Reference)
+			}
+			for _, sum := range []string{a.SHA256, a.ScriptSHA256} {
+				if b, err := hex.DecodeString(sum); err != nil || (sum != "" && len(b) != sha256.Size) {
+					log.Fatalf("Secret %s: invalid SHA-256 %q in allowed_cmds", s.Reference, sum)
+				}
+			}
+			allowed[j] = secretfuse.CmdRule(a)
+		}
+		uids := slices.Clone(s.AllowedUIDs)
+		for _, name := range s.AllowedUsers {
+			u, err := user.Lookup(name)
+			if err != nil {
+				log.Fatalf("Secret %s: %v", s.Reference, err)
+			}
+			uid, err := strconv.ParseUint(u.Uid, 10, 32)
+			if err != nil {
+				log.Fatalf("Secret %s: user %s has non-numeric uid %q", s.Reference, name, u.Uid)
+			}
+			uids = append(uids, uint32(uid))
+		}
+		// Processes possessing the cache keyring could read these past their rules
+		if maxR > 0 || len(allowed) > 0 || len(uids) > 0 || len(s.AllowedGIDs) > 0 {
+			refs, _ := secretfuse.TemplateReferences(s.Template)
+			private = append(private, s.Reference)
+			private = append(private, refs...)
+		}
+		if *allowOther && len(uids) == 0 && len(s.AllowedGIDs) == 0 {
+			uids = []uint32{uint32(os.Getuid())}
+		}
 		secrets[i] = secretfuse.SecretConfig{
 			Reference:   s.Reference,
 			Filename:    s.Filename,
 			MaxReads:    maxR,
-			AllowedCmds: s.AllowedCmds,
+			AllowedCmds: allowed,
+			AllowedUIDs: uids,
+			AllowedGIDs: s.AllowedGIDs,
 			SymlinkTo:   s.SymlinkTo,
 			Writable:    s.Writable,
 			OPAccount:   s.OPAccount,
+			Template:    s.Template,
+			Transform:   s.Transform,
 		}
 	}
 
 	ctx := context.Background()
 
-	refs := make([]string, len(secrets))
-	for i, s := range secrets {
-		refs[i] = s.Reference
+	router, err := newRouter(ctx, cfg, secrets)
+	if err != nil {
+		log.Fatalf("Failed to initialize secret providers: %v", err)
 	}
 
-	// Initialize secret manager (uses desktop app auth via OP_ACCOUNT or --account flag)
-	// Priority: env var > config file
-	account := os.Getenv("OP_ACCOUNT")
-	if account == "" {
-		account = cfg.OPAccount
-	}
-	manager, err := secretmanager.NewOnePasswordManager(ctx, refs, account)
-	if err != nil {
-		log.Fatalf("Failed to initialize 1Password: %v", err)
+	var manager secretmanager.SecretManager = router
+	if cfg.Cache != nil {
+		manager, err = secretmanager.NewKeyringCache(router, cfg.Cache.Keyring, cfg.Cache.TTL, private)
+		if err != nil {
+			log.Fatalf("Failed to initialize keyring cache: %v", err)
+		}
 	}
 
 	if err := os.MkdirAll(*mountPoint, 0755); err != nil {
@@ -116,6 +460,7 @@ func main() {
 		MountOptions: fuse.MountOptions{
 			Name:        "secrets-fuse",
 			DirectMount: true,
+			AllowOther:  *allowOther,
 			Debug:       *debug,
 		},
 		// Disable caching to ensure fresh reads after writes
@@ -129,6 +474,14 @@ func main() {
 		log.Fatalf("Mount failed: %v", err)
 	}
 
+	var gate *secretfuse.Gate
+	if *useFanotify {
+		gate, err = secretfuse.StartGate(*mountPoint, root)
+		if err != nil {
+			log.Printf("fanotify enforcement unavailable, falling back to FUSE checks: %v", err)
+		}
+	}
+
 	fmt.Printf("Secrets mounted at %s (provider: %s)\n", *mountPoint, manager.Name())
 	fmt.Printf("Configured secrets:\n")
 	for _, s := range secrets {
@@ -151,6 +504,24 @@ func main() {
 		}
 	}
 
+	// SIGHUP re-expands wildcard references and drops cached values
+	hupChan := make(chan os.Signal, 1)
+	signal.Notify(hupChan, syscall.SIGHUP)
+	go func() {
+		for range hupChan {
+			if cache, ok := manager.(*secretmanager.KeyringCache); ok {
+				if err := cache.Clear(); err != nil {
+					log.Printf("Clearing keyring cache failed: %v", err)
+				}
+			}
+			if err := root.Refresh(ctx); err != nil {
+				log.Printf("Refresh failed: %v", err)
+				continue
+			}
+			log.Printf("Refreshed wildcard references")
+		}
+	}()
+
 	// Handle graceful shutdown
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
@@ -159,6 +530,10 @@ func main() {
 		<-sigChan
 		fmt.Println("\nUnmounting...")
 
+		if gate != nil {
+			gate.Close()
+		}
+
 		for _, link := range symlinks {
 			if err := os.Remove(link); err != nil {
 				fmt.Printf("Failed to remove symlink %s: %v\n", link, err)
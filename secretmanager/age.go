@@ -0,0 +1,214 @@
+package secretmanager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// AgeConfig configures decryption of plain .age files
+type AgeConfig struct {
+	IdentityFile string   // defaults to SOPS_AGE_KEY_FILE or ~/.config/sops/age/keys.txt
+	Recipients   []string // used for writes; defaults to the identities' own recipients
+	BaseDir      string   // relative references are resolved against this directory
+}
+
+// AgeManager resolves age://path/file.age references by decrypting the file
+// in memory, so no plaintext copy is written to disk.
+type AgeManager struct {
+	identities []age.Identity
+	recipients []age.Recipient
+	baseDir    string
+	secrets    []string // configured secret references
+}
+
+func defaultAgeKeyFile() string {
+	if path := os.Getenv("SOPS_AGE_KEY_FILE"); path != "" {
+		return path
+	}
+	return "~/.config/sops/age/keys.txt"
+}
+
+func NewAgeManager(ctx context.Context, secrets []string, cfg AgeConfig) (*AgeManager, error) {
+	identityFile := cfg.IdentityFile
+	if identityFile == "" {
+		identityFile = defaultAgeKeyFile()
+	}
+
+	data, err := readTokenFile(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading age identities: %w", err)
+	}
+	identities, err := age.ParseIdentities(strings.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("parsing age identities: %w", err)
+	}
+
+	var recipients []age.Recipient
+	if len(cfg.Recipients) > 0 {
+		recipients, err = age.ParseRecipients(strings.NewReader(strings.Join(cfg.Recipients, "\n")))
+		if err != nil {
+			return nil, fmt.Errorf("parsing age recipients: %w", err)
+		}
+	} else {
+		for _, id := range identities {
+			if x, ok := id.(*age.X25519Identity); ok {
+				recipients = append(recipients, x.Recipient())
+			}
+		}
+	}
+
+	return &AgeManager{
+		identities: identities,
+		recipients: recipients,
+		baseDir:    expandHome(cfg.BaseDir),
+		secrets:    secrets,
+	}, nil
+}
+
+// resolvePath maps the path part of a file-based reference to a file on disk.
+// "scheme:///abs/path" is absolute, "scheme://rel/path" is relative to baseDir.
+func resolvePath(baseDir, path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(baseDir, path)
+}
+
+func parseAgeReference(reference string) (string, error) {
+	if !strings.HasPrefix(reference, "age://") {
+		return "", fmt.Errorf("invalid reference format: must start with age://")
+	}
+	path := strings.TrimPrefix(reference, "age://")
+	if path == "" {
+		return "", fmt.Errorf("invalid reference format: expected age://path/to/file.age")
+	}
+	return path, nil
+}
+
+const armorHeader = "-----BEGIN AGE ENCRYPTED FILE-----"
+
+func (m *AgeManager) Resolve(ctx context.Context, reference string) (string, error) {
+	path, err := parseAgeReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(resolvePath(m.baseDir, path))
+	if err != nil {
+		return "", err
+	}
+
+	var src io.Reader = bytes.NewReader(data)
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader)) {
+		src = armor.NewReader(bufio.NewReader(bytes.NewReader(data)))
+	}
+
+	r, err := age.Decrypt(src, m.identities...)
+	if err != nil {
+		return "", fmt.Errorf("age decrypt %s: %w", path, err)
+	}
+	out, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("age decrypt %s: %w", path, err)
+	}
+	return string(out), nil
+}
+
+func (m *AgeManager) Write(ctx context.Context, reference string, value string) error {
+	path, err := parseAgeReference(reference)
+	if err != nil {
+		return err
+	}
+	if len(m.recipients) == 0 {
+		return fmt.Errorf("no age recipients to encrypt to")
+	}
+
+	file := resolvePath(m.baseDir, path)
+	armored := false
+	if old, err := os.ReadFile(file); err == nil {
+		armored = bytes.HasPrefix(bytes.TrimSpace(old), []byte(armorHeader))
+	}
+
+	var buf bytes.Buffer
+	var dst io.WriteCloser = nopWriteCloser{&buf}
+	if armored {
+		dst = armor.NewWriter(&buf)
+	}
+	enc, err := age.Encrypt(dst, m.recipients...)
+	if err != nil {
+		return fmt.Errorf("age encrypt %s: %w", path, err)
+	}
+	if _, err := io.WriteString(enc, value); err != nil {
+		return err
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return writeFileAtomic(file, buf.Bytes())
+}
+
+func (m *AgeManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *AgeManager) Name() string {
+	return "age"
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
+
+// writeFileAtomic replaces path with data via a temporary file in the same
+// directory, keeping the original permissions if the file exists. A symlink
+// is followed so its target is replaced rather than the link itself.
+func writeFileAtomic(path string, data []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	perm := os.FileMode(0600)
+	if info, err := os.Stat(path); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,76 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+func newTestAgeManager(t *testing.T) (*AgeManager, string) {
+	t.Helper()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "keys.txt")
+	if err := os.WriteFile(keyFile, []byte("# test key\n"+identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewAgeManager(context.Background(), nil, AgeConfig{IdentityFile: keyFile, BaseDir: dir})
+	if err != nil {
+		t.Fatalf("NewAgeManager: %v", err)
+	}
+	return m, dir
+}
+
+func TestAgeRoundTrip(t *testing.T) {
+	m, dir := newTestAgeManager(t)
+	ctx := context.Background()
+
+	if err := m.Write(ctx, "age://db.age", "hunter2"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dir, "db.age"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "hunter2") {
+		t.Fatal("plaintext found in encrypted file")
+	}
+
+	for _, ref := range []string{"age://db.age", "age://" + filepath.Join(dir, "db.age")} {
+		if got, err := m.Resolve(ctx, ref); err != nil || got != "hunter2" {
+			t.Errorf("Resolve(%s): got %q, %v", ref, got, err)
+		}
+	}
+}
+
+func TestAgeArmoredPreserved(t *testing.T) {
+	m, dir := newTestAgeManager(t)
+	ctx := context.Background()
+
+	path := filepath.Join(dir, "armored.age")
+	os.WriteFile(path, []byte(armorHeader+"\nplaceholder\n-----END AGE ENCRYPTED FILE-----\n"), 0640)
+
+	if err := m.Write(ctx, "age://armored.age", "value"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	raw, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(raw), armorHeader) {
+		t.Errorf("armored file rewritten without armor: %q", raw)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("permissions not preserved: %v", info.Mode().Perm())
+	}
+	if got, err := m.Resolve(ctx, "age://armored.age"); err != nil || got != "value" {
+		t.Errorf("Resolve: got %q, %v", got, err)
+	}
+}
@@ -0,0 +1,327 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// AWSConfig configures access to AWS Secrets Manager and SSM Parameter
+// Store. Credentials come from the standard chain (environment, shared
+// config/SSO, IMDS, ...).
+type AWSConfig struct {
+	Region   string // defaults to AWS_REGION or the profile's region
+	Profile  string // defaults to AWS_PROFILE
+	Endpoint string // overrides the service endpoint, e.g. for LocalStack
+
+	SecretsPrefix  string // if set, ListSecrets includes secrets with this name prefix
+	ParametersPath string // if set, ListSecrets includes parameters below this path
+}
+
+func loadAWSConfig(ctx context.Context, cfg AWSConfig) (aws.Config, error) {
+	var opts []func(*awsconfig.LoadOptions) error
+	if cfg.Region != "" {
+		opts = append(opts, awsconfig.WithRegion(cfg.Region))
+	}
+	if cfg.Profile != "" {
+		opts = append(opts, awsconfig.WithSharedConfigProfile(cfg.Profile))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, fmt.Errorf("loading AWS config: %w", err)
+	}
+	if cfg.Endpoint != "" {
+		awsCfg.BaseEndpoint = aws.String(cfg.Endpoint)
+	}
+	return awsCfg, nil
+}
+
+// mergeReferences appends listed references not already configured
+func mergeReferences(configured, listed []string) []string {
+	refs := slices.Clone(configured)
+	for _, ref := range listed {
+		if !slices.Contains(refs, ref) {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// AWSSecretsManager resolves aws-sm://name[#key] references. The key selects
+// a field when the secret string is a JSON object.
+type AWSSecretsManager struct {
+	client  *secretsmanager.Client
+	secrets []string // configured secret references
+	prefix  string
+}
+
+func NewAWSSecretsManager(ctx context.Context, secrets []string, cfg AWSConfig) (*AWSSecretsManager, error) {
+	awsCfg, err := loadAWSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &AWSSecretsManager{
+		client:  secretsmanager.NewFromConfig(awsCfg),
+		secrets: secrets,
+		prefix:  cfg.SecretsPrefix,
+	}, nil
+}
+
+// parseAWSSecretReference extracts the secret name (or ARN) and optional JSON key from "aws-sm://name#key"
+func parseAWSSecretReference(reference string) (name, key string, err error) {
+	if !strings.HasPrefix(reference, "aws-sm://") {
+		return "", "", fmt.Errorf("invalid reference format: must start with aws-sm://")
+	}
+	name, key, _ = strings.Cut(strings.TrimPrefix(reference, "aws-sm://"), "#")
+	if name == "" {
+		return "", "", fmt.Errorf("invalid reference format: expected aws-sm://<name>[#key]")
+	}
+	return name, key, nil
+}
+
+// current returns the AWSCURRENT secret value and whether it is stored as
+// SecretBinary, or ok=false if the secret does not exist
+func (m *AWSSecretsManager) current(ctx context.Context, name string) (value string, binary, ok bool, err error) {
+	out, err := m.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	var notFound *smtypes.ResourceNotFoundException
+	if errors.As(err, &notFound) {
+		return "", false, false, nil
+	}
+	if err != nil {
+		return "", false, false, err
+	}
+	if out.SecretString != nil {
+		return *out.SecretString, false, true, nil
+	}
+	return string(out.SecretBinary), true, true, nil
+}
+
+func (m *AWSSecretsManager) Resolve(ctx context.Context, reference string) (string, error) {
+	name, key, err := parseAWSSecretReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	value, _, ok, err := m.current(ctx, name)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+	if !ok {
+		return "", fmt.Errorf("secret %s not found", name)
+	}
+	if key == "" {
+		return value, nil
+	}
+
+	var data map[string]any
+	if err := json.Unmarshal([]byte(value), &data); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object: %w", name, err)
+	}
+	val, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in secret %s", key, name)
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+// Write stores value as a new version of the secret. Secrets Manager moves
+// the AWSPREVIOUS label to the version it replaces, so no backup field is
+// needed. Missing secrets are created, and binary secrets stay binary.
+func (m *AWSSecretsManager) Write(ctx context.Context, reference string, value string) error {
+	name, key, err := parseAWSSecretReference(reference)
+	if err != nil {
+		return err
+	}
+
+	old, binary, exists, err := m.current(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+
+	if key != "" {
+		data := make(map[string]any)
+		if exists && old != "" {
+			if err := json.Unmarshal([]byte(old), &data); err != nil {
+				return fmt.Errorf("secret %s is not a JSON object: %w", name, err)
+			}
+		}
+		data[key] = value
+		out, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		value = string(out)
+	}
+
+	if !exists {
+		_, err = m.client.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
+			Name:         aws.String(name),
+			SecretString: aws.String(value),
+		})
+	} else if binary {
+		_, err = m.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+			SecretId:     aws.String(name),
+			SecretBinary: []byte(value),
+		})
+	} else {
+		_, err = m.client.PutSecretValue(ctx, &secretsmanager.PutSecretValueInput{
+			SecretId:     aws.String(name),
+			SecretString: aws.String(value),
+		})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write secret %s: %w", name, err)
+	}
+	return nil
+}
+
+func (m *AWSSecretsManager) ListSecrets(ctx context.Context) ([]string, error) {
+	if m.prefix == "" {
+		return m.secrets, nil
+	}
+
+	var listed []string
+	p := secretsmanager.NewListSecretsPaginator(m.client, &secretsmanager.ListSecretsInput{
+		Filters: []smtypes.Filter{{Key: smtypes.FilterNameStringTypeName, Values: []string{m.prefix}}},
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing secrets: %w", err)
+		}
+		for _, s := range page.SecretList {
+			// The name filter also matches words inside the name
+			if name := aws.ToString(s.Name); strings.HasPrefix(name, m.prefix) {
+				listed = append(listed, "aws-sm://"+name)
+			}
+		}
+	}
+	return mergeReferences(m.secrets, listed), nil
+}
+
+func (m *AWSSecretsManager) Name() string {
+	return "aws-sm"
+}
+
+// SSMManager resolves ssm:///path/to/param references to SSM Parameter Store
+// parameters, decrypting SecureString values.
+type SSMManager struct {
+	client  *ssm.Client
+	secrets []string // configured secret references
+	path    string
+}
+
+func NewSSMManager(ctx context.Context, secrets []string, cfg AWSConfig) (*SSMManager, error) {
+	awsCfg, err := loadAWSConfig(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &SSMManager{
+		client:  ssm.NewFromConfig(awsCfg),
+		secrets: secrets,
+		path:    cfg.ParametersPath,
+	}, nil
+}
+
+// parseSSMReference extracts the parameter name from "ssm:///path/param" or "ssm://param"
+func parseSSMReference(reference string) (string, error) {
+	if !strings.HasPrefix(reference, "ssm://") {
+		return "", fmt.Errorf("invalid reference format: must start with ssm://")
+	}
+	name := strings.TrimPrefix(reference, "ssm://")
+	if strings.Trim(name, "/") == "" {
+		return "", fmt.Errorf("invalid reference format: expected ssm:///path/to/param")
+	}
+	return name, nil
+}
+
+func (m *SSMManager) Resolve(ctx context.Context, reference string) (string, error) {
+	name, err := parseSSMReference(reference)
+	if err != nil {
+		return "", err
+	}
+	out, err := m.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read parameter %s: %w", name, err)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
+
+// Write overwrites the parameter, keeping its type; Parameter Store keeps the
+// old value in the parameter's history. New parameters are SecureStrings.
+func (m *SSMManager) Write(ctx context.Context, reference string, value string) error {
+	name, err := parseSSMReference(reference)
+	if err != nil {
+		return err
+	}
+
+	paramType := ssmtypes.ParameterTypeSecureString
+	out, err := m.client.GetParameter(ctx, &ssm.GetParameterInput{Name: aws.String(name)})
+	var notFound *ssmtypes.ParameterNotFound
+	switch {
+	case err == nil:
+		paramType = out.Parameter.Type
+	case !errors.As(err, &notFound):
+		return fmt.Errorf("failed to read parameter %s: %w", name, err)
+	}
+
+	_, err = m.client.PutParameter(ctx, &ssm.PutParameterInput{
+		Name:      aws.String(name),
+		Value:     aws.String(value),
+		Type:      paramType,
+		Overwrite: aws.Bool(true),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write parameter %s: %w", name, err)
+	}
+	return nil
+}
+
+func (m *SSMManager) ListSecrets(ctx context.Context) ([]string, error) {
+	if m.path == "" {
+		return m.secrets, nil
+	}
+
+	var listed []string
+	p := ssm.NewDescribeParametersPaginator(m.client, &ssm.DescribeParametersInput{
+		ParameterFilters: []ssmtypes.ParameterStringFilter{{
+			Key:    aws.String("Name"),
+			Option: aws.String("BeginsWith"),
+			Values: []string{m.path},
+		}},
+	})
+	for p.HasMorePages() {
+		page, err := p.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing parameters: %w", err)
+		}
+		for _, param := range page.Parameters {
+			listed = append(listed, "ssm://"+aws.ToString(param.Name))
+		}
+	}
+	return mergeReferences(m.secrets, listed), nil
+}
+
+func (m *SSMManager) Name() string {
+	return "ssm"
+}
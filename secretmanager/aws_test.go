@@ -0,0 +1,264 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAWS emulates the Secrets Manager and SSM JSON APIs the managers use
+type fakeAWS struct {
+	mu       sync.Mutex
+	versions map[string][]string // secret name -> values, oldest first
+	binary   map[string]bool     // secrets stored as SecretBinary
+	params   map[string]map[string]string
+}
+
+func newFakeAWS(t *testing.T) (*fakeAWS, AWSConfig) {
+	t.Helper()
+	dir := t.TempDir()
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	f := &fakeAWS{
+		versions: make(map[string][]string),
+		binary:   make(map[string]bool),
+		params:   make(map[string]map[string]string),
+	}
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	return f, AWSConfig{Region: "us-east-1", Endpoint: srv.URL}
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var in map[string]any
+	json.NewDecoder(r.Body).Decode(&in)
+	str := func(k string) string { s, _ := in[k].(string); return s }
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reply := func(v any) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		json.NewEncoder(w).Encode(v)
+	}
+	fail := func(code string) {
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"__type": code, "message": code})
+	}
+
+	_, action, _ := strings.Cut(r.Header.Get("X-Amz-Target"), ".")
+	switch action {
+	case "GetSecretValue":
+		v := f.versions[str("SecretId")]
+		if len(v) == 0 {
+			fail("ResourceNotFoundException")
+			return
+		}
+		if f.binary[str("SecretId")] {
+			// Blobs travel base64-encoded, as encoding/json does for []byte
+			reply(map[string]any{"Name": str("SecretId"), "SecretBinary": []byte(v[len(v)-1])})
+			return
+		}
+		reply(map[string]any{"Name": str("SecretId"), "SecretString": v[len(v)-1]})
+	case "CreateSecret":
+		if len(f.versions[str("Name")]) > 0 {
+			fail("ResourceExistsException")
+			return
+		}
+		f.versions[str("Name")] = []string{str("SecretString")}
+		reply(map[string]any{"Name": str("Name")})
+	case "PutSecretValue":
+		if len(f.versions[str("SecretId")]) == 0 {
+			fail("ResourceNotFoundException")
+			return
+		}
+		value := str("SecretString")
+		if blob, ok := in["SecretBinary"].(string); ok {
+			b, _ := base64.StdEncoding.DecodeString(blob)
+			value = string(b)
+		}
+		f.binary[str("SecretId")] = in["SecretBinary"] != nil
+		f.versions[str("SecretId")] = append(f.versions[str("SecretId")], value)
+		reply(map[string]any{"Name": str("SecretId")})
+	case "ListSecrets":
+		var list []map[string]string
+		for name := range f.versions {
+			list = append(list, map[string]string{"Name": name})
+		}
+		reply(map[string]any{"SecretList": list})
+	case "GetParameter":
+		p, ok := f.params[str("Name")]
+		if !ok {
+			fail("ParameterNotFound")
+			return
+		}
+		reply(map[string]any{"Parameter": p})
+	case "PutParameter":
+		if _, ok := f.params[str("Name")]; ok && in["Overwrite"] != true {
+			fail("ParameterAlreadyExists")
+			return
+		}
+		f.params[str("Name")] = map[string]string{"Name": str("Name"), "Value": str("Value"), "Type": str("Type")}
+		reply(map[string]any{"Version": 1})
+	case "DescribeParameters":
+		var req struct{ ParameterFilters []struct{ Values []string } }
+		b, _ := json.Marshal(in)
+		json.Unmarshal(b, &req)
+		var list []map[string]string
+		for name := range f.params {
+			if len(req.ParameterFilters) == 0 || strings.HasPrefix(name, req.ParameterFilters[0].Values[0]) {
+				list = append(list, map[string]string{"Name": name})
+			}
+		}
+		reply(map[string]any{"Parameters": list})
+	default:
+		fail("UnknownOperationException")
+	}
+}
+
+func TestParseAWSReferences(t *testing.T) {
+	if name, key, err := parseAWSSecretReference("aws-sm://prod/db#password"); err != nil || name != "prod/db" || key != "password" {
+		t.Errorf("aws-sm: got %q %q %v", name, key, err)
+	}
+	if _, _, err := parseAWSSecretReference("aws-sm://#key"); err == nil {
+		t.Error("expected empty secret name to fail")
+	}
+	if name, err := parseSSMReference("ssm:///app/db/password"); err != nil || name != "/app/db/password" {
+		t.Errorf("ssm: got %q %v", name, err)
+	}
+	if name, err := parseSSMReference("ssm://token"); err != nil || name != "token" {
+		t.Errorf("ssm: got %q %v", name, err)
+	}
+	if _, err := parseSSMReference("ssm:///"); err == nil {
+		t.Error("expected empty parameter name to fail")
+	}
+}
+
+func TestAWSSecretsManager(t *testing.T) {
+	fake, cfg := newFakeAWS(t)
+	ctx := context.Background()
+	cfg.SecretsPrefix = "prod/"
+
+	fake.versions["prod/db"] = []string{`{"user":"app","password":"old","port":5432}`}
+	fake.versions["staging/db"] = []string{"x"}
+
+	m, err := NewAWSSecretsManager(ctx, []string{"aws-sm://prod/db#password"}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := m.Resolve(ctx, "aws-sm://prod/db#password"); err != nil || got != "old" {
+		t.Errorf("Resolve key: got %q, %v", got, err)
+	}
+	if got, _ := m.Resolve(ctx, "aws-sm://prod/db#port"); got != "5432" {
+		t.Errorf("Resolve number: got %q", got)
+	}
+	if _, err := m.Resolve(ctx, "aws-sm://prod/db#missing"); err == nil {
+		t.Error("expected missing key to fail")
+	}
+	if _, err := m.Resolve(ctx, "aws-sm://prod/nope"); err == nil {
+		t.Error("expected missing secret to fail")
+	}
+
+	// Updating a key writes a new version with the other keys intact
+	if err := m.Write(ctx, "aws-sm://prod/db#password", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.versions["prod/db"]); n != 2 {
+		t.Fatalf("expected 2 versions, got %d", n)
+	}
+	var latest map[string]any
+	json.Unmarshal([]byte(fake.versions["prod/db"][1]), &latest)
+	if latest["password"] != "new" || latest["user"] != "app" {
+		t.Errorf("unexpected new version: %v", latest)
+	}
+	if _, ok := latest["password_previous"]; ok {
+		t.Error("Write should not add a _previous field")
+	}
+
+	// Binary secrets are written back as binary
+	fake.versions["prod/keystore"] = []string{"\x00\x01jks"}
+	fake.binary["prod/keystore"] = true
+	if got, _ := m.Resolve(ctx, "aws-sm://prod/keystore"); got != "\x00\x01jks" {
+		t.Errorf("Resolve binary: got %q", got)
+	}
+	if err := m.Write(ctx, "aws-sm://prod/keystore", "\x00\x02jks"); err != nil {
+		t.Fatal(err)
+	}
+	if !fake.binary["prod/keystore"] || fake.versions["prod/keystore"][1] != "\x00\x02jks" {
+		t.Errorf("binary secret written as %q (binary %v)", fake.versions["prod/keystore"][1], fake.binary["prod/keystore"])
+	}
+
+	// Missing secrets are created
+	if err := m.Write(ctx, "aws-sm://prod/api-key", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, "aws-sm://prod/api-key"); got != "k1" {
+		t.Errorf("Resolve created secret: got %q", got)
+	}
+
+	listed, err := m.ListSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(listed)
+	want := []string{"aws-sm://prod/api-key", "aws-sm://prod/db", "aws-sm://prod/db#password", "aws-sm://prod/keystore"}
+	if !slices.Equal(listed, want) {
+		t.Errorf("ListSecrets: got %v, want %v", listed, want)
+	}
+}
+
+func TestSSMManager(t *testing.T) {
+	fake, cfg := newFakeAWS(t)
+	ctx := context.Background()
+	cfg.ParametersPath = "/app/"
+
+	fake.params["/app/url"] = map[string]string{"Name": "/app/url", "Value": "https://example.com", "Type": "String"}
+	fake.params["/other/x"] = map[string]string{"Name": "/other/x", "Value": "x", "Type": "String"}
+
+	m, err := NewSSMManager(ctx, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := m.Resolve(ctx, "ssm:///app/url"); err != nil || got != "https://example.com" {
+		t.Errorf("Resolve: got %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "ssm:///app/missing"); err == nil {
+		t.Error("expected missing parameter to fail")
+	}
+
+	if err := m.Write(ctx, "ssm:///app/url", "https://example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if p := fake.params["/app/url"]; p["Value"] != "https://example.org" || p["Type"] != "String" {
+		t.Errorf("overwrite should keep the type: %v", p)
+	}
+	if err := m.Write(ctx, "ssm:///app/token", "t0k3n"); err != nil {
+		t.Fatal(err)
+	}
+	if p := fake.params["/app/token"]; p["Type"] != "SecureString" {
+		t.Errorf("new parameters should be SecureString: %v", p)
+	}
+
+	listed, err := m.ListSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(listed)
+	if want := []string{"ssm:///app/token", "ssm:///app/url"}; !slices.Equal(listed, want) {
+		t.Errorf("ListSecrets: got %v, want %v", listed, want)
+	}
+}
@@ -0,0 +1,202 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+)
+
+const azureKeyVaultAPIVersion = "7.4"
+
+// AzureKeyVaultConfig configures access to Azure Key Vault. Without a token,
+// DefaultAzureCredential is used (environment, workload/managed identity,
+// az login).
+type AzureKeyVaultConfig struct {
+	Endpoint  string // vault URL, "{vault}" is replaced by the vault name; defaults to https://{vault}.vault.azure.net
+	Token     string // static access token for the vault.azure.net resource
+	TokenFile string
+}
+
+// AzureKeyVaultManager resolves azkv://vault/secret[/version] references
+// through the Key Vault REST API.
+type AzureKeyVaultManager struct {
+	endpoint string
+	token    func(ctx context.Context) (string, error)
+	http     *http.Client
+	secrets  []string // configured secret references
+}
+
+func NewAzureKeyVaultManager(ctx context.Context, secrets []string, cfg AzureKeyVaultConfig) (*AzureKeyVaultManager, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://{vault}.vault.azure.net"
+	}
+
+	token := cfg.Token
+	if token == "" && cfg.TokenFile != "" {
+		var err error
+		if token, err = readTokenFile(cfg.TokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	m := &AzureKeyVaultManager{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		http:     &http.Client{Timeout: 30 * time.Second},
+		secrets:  secrets,
+	}
+	if token != "" {
+		m.token = func(context.Context) (string, error) { return token, nil }
+		return m, nil
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating Azure credential: %w", err)
+	}
+	m.token = func(ctx context.Context) (string, error) {
+		tok, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://vault.azure.net/.default"}})
+		return tok.Token, err
+	}
+	return m, nil
+}
+
+// azureAPIError is the error body returned by Key Vault
+type azureAPIError struct {
+	StatusCode int
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
+
+func (e *azureAPIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// do sends a request to the vault and decodes the JSON response into out
+func (m *AzureKeyVaultManager) do(ctx context.Context, method, vault, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	base := strings.ReplaceAll(m.endpoint, "{vault}", vault)
+	req, err := http.NewRequestWithContext(ctx, method, base+path+"?api-version="+azureKeyVaultAPIVersion, reqBody)
+	if err != nil {
+		return err
+	}
+	token, err := m.token(ctx)
+	if err != nil {
+		return fmt.Errorf("getting access token: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error azureAPIError `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		apiErr.Error.StatusCode = resp.StatusCode
+		return &apiErr.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// parseAzureReference extracts the vault, secret name and optional version from "azkv://vault/secret[/version]"
+func parseAzureReference(reference string) (vault, secret, version string, err error) {
+	if !strings.HasPrefix(reference, "azkv://") {
+		return "", "", "", fmt.Errorf("invalid reference format: must start with azkv://")
+	}
+	parts := strings.Split(strings.TrimPrefix(reference, "azkv://"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" || len(parts) == 3 && parts[2] == "" {
+		return "", "", "", fmt.Errorf("invalid reference format: expected azkv://<vault>/<secret>[/<version>]")
+	}
+	if len(parts) == 3 {
+		version = parts[2]
+	}
+	return parts[0], parts[1], version, nil
+}
+
+type azureSecretBundle struct {
+	Value       string            `json:"value"`
+	ContentType string            `json:"contentType,omitempty"`
+	Tags        map[string]string `json:"tags,omitempty"`
+}
+
+func (m *AzureKeyVaultManager) Resolve(ctx context.Context, reference string) (string, error) {
+	vault, secret, version, err := parseAzureReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	path := "/secrets/" + url.PathEscape(secret)
+	if version != "" {
+		path += "/" + url.PathEscape(version)
+	}
+	var bundle azureSecretBundle
+	if err := m.do(ctx, http.MethodGet, vault, path, nil, &bundle); err != nil {
+		return "", fmt.Errorf("failed to read %s/%s: %w", vault, secret, err)
+	}
+	return bundle.Value, nil
+}
+
+// Write sets the secret, which adds a new current version. The content type
+// and tags of the current version are carried over; older versions stay
+// enabled.
+func (m *AzureKeyVaultManager) Write(ctx context.Context, reference string, value string) error {
+	vault, secret, version, err := parseAzureReference(reference)
+	if err != nil {
+		return err
+	}
+	if version != "" {
+		return fmt.Errorf("cannot write to %s/%s: reference is pinned to version %s", vault, secret, version)
+	}
+
+	path := "/secrets/" + url.PathEscape(secret)
+	var current azureSecretBundle
+	err = m.do(ctx, http.MethodGet, vault, path, nil, &current)
+	var apiErr *azureAPIError
+	if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound) {
+		return fmt.Errorf("failed to read %s/%s: %w", vault, secret, err)
+	}
+
+	current.Value = value
+	if err := m.do(ctx, http.MethodPut, vault, path, current, nil); err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", vault, secret, err)
+	}
+	return nil
+}
+
+func (m *AzureKeyVaultManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *AzureKeyVaultManager) Name() string {
+	return "azkv"
+}
@@ -0,0 +1,124 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeKeyVault emulates the Key Vault secret endpoints the manager uses.
+// Requests arrive as /<vault>/secrets/<name>[/<version>].
+type fakeKeyVault struct {
+	mu       sync.Mutex
+	versions map[string][]azureSecretBundle // "vault/name" -> versions, oldest first
+}
+
+func (f *fakeKeyVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fail := func(code int, errCode string) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"error":{"code":%q,"message":"fake"}}`, errCode)
+	}
+	if r.Header.Get("Authorization") != "Bearer test-token" || r.URL.Query().Get("api-version") == "" {
+		fail(http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 3 || parts[1] != "secrets" {
+		fail(http.StatusNotFound, "NotFound")
+		return
+	}
+	key := parts[0] + "/" + parts[2]
+
+	switch r.Method {
+	case http.MethodGet:
+		versions := f.versions[key]
+		n := len(versions)
+		if len(parts) == 4 {
+			n, _ = strconv.Atoi(parts[3])
+		}
+		if n < 1 || n > len(versions) {
+			fail(http.StatusNotFound, "SecretNotFound")
+			return
+		}
+		json.NewEncoder(w).Encode(versions[n-1])
+	case http.MethodPut:
+		var bundle azureSecretBundle
+		json.NewDecoder(r.Body).Decode(&bundle)
+		f.versions[key] = append(f.versions[key], bundle)
+		json.NewEncoder(w).Encode(bundle)
+	default:
+		fail(http.StatusMethodNotAllowed, "BadRequest")
+	}
+}
+
+func TestParseAzureReference(t *testing.T) {
+	if v, s, ver, err := parseAzureReference("azkv://myvault/db-password/abc123"); err != nil || v != "myvault" || s != "db-password" || ver != "abc123" {
+		t.Errorf("got %q %q %q %v", v, s, ver, err)
+	}
+	if _, _, ver, err := parseAzureReference("azkv://myvault/db-password"); err != nil || ver != "" {
+		t.Errorf("got version %q, %v", ver, err)
+	}
+	for _, ref := range []string{"azkv://myvault", "azkv://myvault/", "azkv:///s", "azkv://v/s/", "azkv://v/s/1/x"} {
+		if _, _, _, err := parseAzureReference(ref); err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+}
+
+func TestAzureKeyVaultManager(t *testing.T) {
+	fake := &fakeKeyVault{versions: map[string][]azureSecretBundle{
+		"prod/db": {{Value: "v1", ContentType: "text/plain", Tags: map[string]string{"team": "web"}}},
+	}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	ctx := context.Background()
+
+	m, err := NewAzureKeyVaultManager(ctx, nil, AzureKeyVaultConfig{Endpoint: srv.URL + "/{vault}", Token: "test-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := m.Resolve(ctx, "azkv://prod/db"); err != nil || got != "v1" {
+		t.Errorf("Resolve: got %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "azkv://prod/missing"); err == nil {
+		t.Error("expected missing secret to fail")
+	}
+
+	if err := m.Write(ctx, "azkv://prod/db", "v2"); err != nil {
+		t.Fatal(err)
+	}
+	versions := fake.versions["prod/db"]
+	if len(versions) != 2 {
+		t.Fatalf("expected 2 versions, got %d", len(versions))
+	}
+	if versions[1].ContentType != "text/plain" || versions[1].Tags["team"] != "web" {
+		t.Errorf("new version should keep content type and tags: %+v", versions[1])
+	}
+	if got, _ := m.Resolve(ctx, "azkv://prod/db"); got != "v2" {
+		t.Errorf("Resolve after write: got %q", got)
+	}
+	if got, _ := m.Resolve(ctx, "azkv://prod/db/1"); got != "v1" {
+		t.Errorf("older version should stay readable, got %q", got)
+	}
+	if err := m.Write(ctx, "azkv://prod/db/1", "x"); err == nil {
+		t.Error("expected write to a pinned version to fail")
+	}
+
+	if err := m.Write(ctx, "azkv://prod/api-key", "k1"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, "azkv://prod/api-key"); got != "k1" {
+		t.Errorf("Resolve created secret: got %q", got)
+	}
+}
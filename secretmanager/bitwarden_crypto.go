@@ -0,0 +1,199 @@
+package secretmanager
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Bitwarden KDF types, as reported by the identity server
+const (
+	bwKDFPBKDF2   = 0
+	bwKDFArgon2id = 1
+)
+
+type bwKDF struct {
+	Type        int
+	Iterations  int
+	Memory      int // MiB, Argon2id only
+	Parallelism int // Argon2id only
+}
+
+// bwKey is a symmetric key: AES-256-CBC encryption key and HMAC-SHA256 key
+type bwKey struct {
+	enc, mac []byte
+}
+
+func bwKeyFromBytes(b []byte) (bwKey, error) {
+	if len(b) != 64 {
+		return bwKey{}, fmt.Errorf("invalid key length %d", len(b))
+	}
+	return bwKey{enc: b[:32], mac: b[32:]}, nil
+}
+
+// bwMasterKey derives the stretched master key from the master password,
+// which decrypts the account's user key
+func bwMasterKey(password, email string, kdf bwKDF) (bwKey, error) {
+	salt := []byte(strings.ToLower(strings.TrimSpace(email)))
+
+	var master []byte
+	switch kdf.Type {
+	case bwKDFPBKDF2:
+		var err error
+		if master, err = pbkdf2.Key(sha256.New, password, salt, kdf.Iterations, 32); err != nil {
+			return bwKey{}, err
+		}
+	case bwKDFArgon2id:
+		saltHash := sha256.Sum256(salt)
+		master = argon2.IDKey([]byte(password), saltHash[:], uint32(kdf.Iterations), uint32(kdf.Memory)*1024, uint8(kdf.Parallelism), 32)
+	default:
+		return bwKey{}, fmt.Errorf("unsupported KDF type %d", kdf.Type)
+	}
+
+	enc, err := hkdf.Expand(sha256.New, master, "enc", 32)
+	if err != nil {
+		return bwKey{}, err
+	}
+	mac, err := hkdf.Expand(sha256.New, master, "mac", 32)
+	if err != nil {
+		return bwKey{}, err
+	}
+	return bwKey{enc: enc, mac: mac}, nil
+}
+
+func (k bwKey) hmac(iv, data []byte) []byte {
+	h := hmac.New(sha256.New, k.mac)
+	h.Write(iv)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// decryptRaw authenticates and decrypts AES-256-CBC data
+func (k bwKey) decryptRaw(iv, data, mac []byte) ([]byte, error) {
+	if !hmac.Equal(mac, k.hmac(iv, data)) {
+		return nil, fmt.Errorf("MAC mismatch (wrong key?)")
+	}
+	if len(iv) != aes.BlockSize || len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("malformed ciphertext")
+	}
+	block, err := aes.NewCipher(k.enc)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(out[len(out)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, fmt.Errorf("invalid padding")
+	}
+	return out[:len(out)-pad], nil
+}
+
+func (k bwKey) encryptRaw(plain []byte) (iv, data, mac []byte, err error) {
+	iv = make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		return nil, nil, nil, err
+	}
+	block, err := aes.NewCipher(k.enc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	data = append(bytes.Clone(plain), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+	return iv, data, k.hmac(iv, data), nil
+}
+
+// decrypt decrypts a type 2 (AesCbc256_HmacSha256_B64) cipher string
+// "2.iv|data|mac". An empty string decrypts to nothing.
+func (k bwKey) decrypt(s string) ([]byte, error) {
+	if s == "" {
+		return nil, nil
+	}
+	encType, rest, _ := strings.Cut(s, ".")
+	if encType != "2" {
+		return nil, fmt.Errorf("unsupported cipher string type %q", encType)
+	}
+	parts := strings.Split(rest, "|")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("malformed cipher string")
+	}
+	var raw [3][]byte
+	for i, p := range parts {
+		var err error
+		if raw[i], err = base64.StdEncoding.DecodeString(p); err != nil {
+			return nil, fmt.Errorf("malformed cipher string: %w", err)
+		}
+	}
+	return k.decryptRaw(raw[0], raw[1], raw[2])
+}
+
+func (k bwKey) decryptString(s string) (string, error) {
+	b, err := k.decrypt(s)
+	return string(b), err
+}
+
+// encrypt produces a type 2 cipher string
+func (k bwKey) encrypt(plain []byte) (string, error) {
+	iv, data, mac, err := k.encryptRaw(plain)
+	if err != nil {
+		return "", err
+	}
+	enc := base64.StdEncoding.EncodeToString
+	return "2." + enc(iv) + "|" + enc(data) + "|" + enc(mac), nil
+}
+
+// decryptBuffer decrypts an encrypted file (attachment) body:
+// type byte 2, 16-byte IV, 32-byte MAC, then the ciphertext
+func (k bwKey) decryptBuffer(b []byte) ([]byte, error) {
+	if len(b) < 1+16+32 || b[0] != 2 {
+		return nil, fmt.Errorf("unsupported encrypted file format")
+	}
+	return k.decryptRaw(b[1:17], b[49:], b[17:49])
+}
+
+// bwPrivateKey decrypts the account's RSA private key, used for organization keys
+func bwPrivateKey(userKey bwKey, s string) (*rsa.PrivateKey, error) {
+	der, err := userKey.decrypt(s)
+	if err != nil {
+		return nil, err
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA")
+	}
+	return rsaKey, nil
+}
+
+// bwRSADecrypt decrypts a type 4 (Rsa2048_OaepSha1_B64) or type 6 (with an
+// unused MAC) cipher string
+func bwRSADecrypt(priv *rsa.PrivateKey, s string) ([]byte, error) {
+	encType, rest, _ := strings.Cut(s, ".")
+	if encType != "4" && encType != "6" {
+		return nil, fmt.Errorf("unsupported cipher string type %q", encType)
+	}
+	data, _, _ := strings.Cut(rest, "|")
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, fmt.Errorf("malformed cipher string: %w", err)
+	}
+	return rsa.DecryptOAEP(sha1.New(), nil, priv, raw, nil)
+}
@@ -0,0 +1,367 @@
+package secretmanager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	bwTestEmail    = "User@Example.com"
+	bwTestPassword = "correct horse battery staple"
+)
+
+// fakeVaultwarden serves an encrypted vault the way a Bitwarden server
+// does, from keys generated by the test
+type fakeVaultwarden struct {
+	t   *testing.T
+	kdf bwKDF
+
+	userKey bwKey
+	itemKey bwKey
+	orgKey  bwKey
+
+	mu          sync.Mutex
+	encUserKey  string
+	privateKey  string
+	encOrgKey   string
+	revision    int
+	ciphers     map[string]map[string]any
+	attachments map[string][]byte
+}
+
+func randomKey(t *testing.T) (bwKey, []byte) {
+	raw := make([]byte, 64)
+	rand.Read(raw)
+	key, err := bwKeyFromBytes(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, raw
+}
+
+func mustEncrypt(t *testing.T, key bwKey, plain string) string {
+	s, err := key.encrypt([]byte(plain))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func newFakeVaultwarden(t *testing.T, kdf bwKDF) *fakeVaultwarden {
+	t.Helper()
+	f := &fakeVaultwarden{t: t, kdf: kdf, revision: 1, attachments: make(map[string][]byte)}
+
+	master, err := bwMasterKey(bwTestPassword, bwTestEmail, kdf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var userRaw, itemRaw, orgRaw []byte
+	f.userKey, userRaw = randomKey(t)
+	f.itemKey, itemRaw = randomKey(t)
+	f.orgKey, orgRaw = randomKey(t)
+	f.encUserKey = mustEncrypt(t, master, string(userRaw))
+
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(priv)
+	f.privateKey = mustEncrypt(t, f.userKey, string(der))
+	encOrg, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, &priv.PublicKey, orgRaw, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.encOrgKey = "4." + base64.StdEncoding.EncodeToString(encOrg)
+
+	// The attachment has its own key, encrypted with the item key
+	attKey, attRaw := randomKey(t)
+	iv, data, mac, err := attKey.encryptRaw([]byte("-----BEGIN CERTIFICATE-----\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.attachments["att1"] = append(append(append([]byte{2}, iv...), mac...), data...)
+
+	f.ciphers = map[string]map[string]any{
+		"c1": {
+			"id": "c1", "type": 1, "folderId": "f1", "revisionDate": "r1",
+			"key":  mustEncrypt(t, f.userKey, string(itemRaw)),
+			"name": mustEncrypt(t, f.itemKey, "db"),
+			"login": map[string]any{
+				"username": mustEncrypt(t, f.itemKey, "app"),
+				"password": mustEncrypt(t, f.itemKey, "s3cret"),
+				"uris":     []any{map[string]any{"uri": mustEncrypt(t, f.itemKey, "postgres://db"), "match": 1}},
+			},
+			"fields": []any{map[string]any{"name": mustEncrypt(t, f.itemKey, "api token"), "value": mustEncrypt(t, f.itemKey, "tok"), "type": 1}},
+			"attachments": []any{map[string]any{
+				"id": "att1", "fileName": mustEncrypt(t, f.itemKey, "tls.crt"), "key": mustEncrypt(t, f.itemKey, string(attRaw)),
+			}},
+		},
+		"c2": {
+			"id": "c2", "type": 2, "organizationId": "o1", "revisionDate": "r1",
+			"name":  mustEncrypt(t, f.orgKey, "shared"),
+			"notes": mustEncrypt(t, f.orgKey, "team note"),
+		},
+		"c3": {"id": "c3", "type": 2, "revisionDate": "r1", "name": mustEncrypt(t, f.userKey, "dup"), "notes": mustEncrypt(t, f.userKey, "one")},
+		"c4": {"id": "c4", "type": 2, "folderId": "f1", "revisionDate": "r1", "name": mustEncrypt(t, f.userKey, "dup"), "notes": mustEncrypt(t, f.userKey, "two")},
+	}
+	return f
+}
+
+func (f *fakeVaultwarden) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.URL.Path == "/identity/connect/token" {
+		r.ParseForm()
+		if r.PostForm.Get("client_id") != "user.test" || r.PostForm.Get("client_secret") != "secret" || r.PostForm.Get("deviceIdentifier") == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid_client","error_description":"bad API key"}`)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "access", "expires_in": 3600, "token_type": "Bearer",
+			"Key": f.encUserKey, "Kdf": f.kdf.Type, "KdfIterations": f.kdf.Iterations,
+			"KdfMemory": f.kdf.Memory, "KdfParallelism": f.kdf.Parallelism,
+		})
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/attachments/") {
+		w.Write(f.attachments[strings.TrimPrefix(r.URL.Path, "/attachments/")])
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer access" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api")
+	switch {
+	case path == "/accounts/revision-date":
+		fmt.Fprint(w, f.revision)
+	case path == "/sync":
+		ciphers := make([]any, 0, len(f.ciphers))
+		for _, c := range f.ciphers {
+			ciphers = append(ciphers, c)
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"profile": map[string]any{
+				"email": bwTestEmail, "privateKey": f.privateKey,
+				"organizations": []any{map[string]any{"id": "o1", "key": f.encOrgKey}},
+			},
+			"folders": []any{map[string]any{"id": "f1", "name": mustEncrypt(f.t, f.userKey, "Servers/Web")}},
+			"ciphers": ciphers,
+		})
+	case strings.HasPrefix(path, "/ciphers/") && strings.Contains(path, "/attachment/"):
+		_, id, _ := strings.Cut(path, "/attachment/")
+		fmt.Fprintf(w, `{"url":"/attachments/%s"}`, id)
+	case strings.HasPrefix(path, "/ciphers/") && r.Method == http.MethodPut:
+		id := strings.TrimPrefix(path, "/ciphers/")
+		var c map[string]any
+		json.NewDecoder(r.Body).Decode(&c)
+		if c["lastKnownRevisionDate"] != f.ciphers[id]["revisionDate"] {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"message":"The cipher you are updating is out of date."}`)
+			return
+		}
+		f.revision++
+		c["revisionDate"] = fmt.Sprintf("r%d", f.revision)
+		delete(c, "lastKnownRevisionDate")
+		f.ciphers[id] = c
+		json.NewEncoder(w).Encode(c)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestParseBitwardenReference(t *testing.T) {
+	tests := []struct {
+		ref, folder, item, field string
+		wantErr                  bool
+	}{
+		{ref: "bw://Servers/Web/db/password", folder: "Servers/Web", item: "db", field: "password"},
+		{ref: "bw://db/password", item: "db", field: "password"},
+		{ref: "bw://db", wantErr: true},
+		{ref: "bw://db/", wantErr: true},
+		{ref: "op://db/password", wantErr: true},
+	}
+	for _, tt := range tests {
+		folder, item, field, err := parseBitwardenReference(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if folder != tt.folder || item != tt.item || field != tt.field {
+			t.Errorf("%s: got %q %q %q", tt.ref, folder, item, field)
+		}
+	}
+}
+
+func TestBitwardenCipherStrings(t *testing.T) {
+	key, _ := randomKey(t)
+	enc := mustEncrypt(t, key, "hello")
+	if got, err := key.decryptString(enc); err != nil || got != "hello" {
+		t.Errorf("round trip: got %q, %v", got, err)
+	}
+
+	other, _ := randomKey(t)
+	if _, err := other.decrypt(enc); err == nil {
+		t.Error("expected decrypting with the wrong key to fail")
+	}
+	if _, err := key.decrypt("0." + strings.TrimPrefix(enc, "2.")); err == nil {
+		t.Error("expected unsupported type to fail")
+	}
+	if got, err := key.decryptString(""); err != nil || got != "" {
+		t.Errorf("empty cipher string: got %q, %v", got, err)
+	}
+}
+
+func startVaultwarden(t *testing.T, kdf bwKDF) (*fakeVaultwarden, BitwardenConfig) {
+	t.Helper()
+	fake := newFakeVaultwarden(t, kdf)
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	t.Setenv("BW_PASSWORD", bwTestPassword)
+	return fake, BitwardenConfig{Server: srv.URL, ClientID: "user.test", ClientSecret: "secret"}
+}
+
+func TestBitwardenManager(t *testing.T) {
+	kdfs := map[string]bwKDF{
+		"pbkdf2":   {Type: bwKDFPBKDF2, Iterations: 1000},
+		"argon2id": {Type: bwKDFArgon2id, Iterations: 1, Memory: 1, Parallelism: 1},
+	}
+	for name, kdf := range kdfs {
+		t.Run(name, func(t *testing.T) {
+			_, cfg := startVaultwarden(t, kdf)
+			ctx := context.Background()
+
+			m, err := NewBitwardenManager(ctx, nil, cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for ref, want := range map[string]string{
+				"bw://Servers/Web/db/password":  "s3cret",
+				"bw://db/username":              "app",
+				"bw://db/uri":                   "postgres://db",
+				"bw://db/api token":             "tok",
+				"bw://db/tls.crt":               "-----BEGIN CERTIFICATE-----\n",
+				"bw://c1/password":              "s3cret",
+				"bw://shared/notes":             "team note",
+				"bw://Servers/Web/dup/notes":    "two",
+				"bw://Servers/Web/db/PASSWORD":  "s3cret",
+				"bw://c3/notes":                 "one",
+				"bw://Servers/Web/c4/notes":     "two",
+				"bw://Servers/Web/db/api token": "tok",
+			} {
+				if got, err := m.Resolve(ctx, ref); err != nil || got != want {
+					t.Errorf("Resolve(%s): got %q, %v; want %q", ref, got, err, want)
+				}
+			}
+			for _, ref := range []string{"bw://dup/notes", "bw://db/nosuch", "bw://Other/db/password", "bw://missing/password"} {
+				if _, err := m.Resolve(ctx, ref); err == nil {
+					t.Errorf("Resolve(%s): expected error", ref)
+				}
+			}
+		})
+	}
+}
+
+func TestBitwardenWrongCredentials(t *testing.T) {
+	_, cfg := startVaultwarden(t, bwKDF{Type: bwKDFPBKDF2, Iterations: 1000})
+	ctx := context.Background()
+
+	t.Setenv("BW_PASSWORD", "wrong")
+	if _, err := NewBitwardenManager(ctx, nil, cfg); err == nil || !strings.Contains(err.Error(), "master password") {
+		t.Errorf("expected wrong master password to fail, got %v", err)
+	}
+
+	t.Setenv("BW_PASSWORD", bwTestPassword)
+	cfg.ClientSecret = "nope"
+	if _, err := NewBitwardenManager(ctx, nil, cfg); err == nil {
+		t.Error("expected bad API key to fail")
+	}
+}
+
+func TestBitwardenWrite(t *testing.T) {
+	fake, cfg := startVaultwarden(t, bwKDF{Type: bwKDFPBKDF2, Iterations: 1000})
+	ctx := context.Background()
+
+	m, err := NewBitwardenManager(ctx, nil, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.Write(ctx, "bw://db/password", "n3w"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, "bw://db/password"); got != "n3w" {
+		t.Errorf("Resolve after write: got %q", got)
+	}
+
+	// The value is encrypted with the item key and the old one kept in history
+	c := fake.ciphers["c1"]
+	if got, err := fake.itemKey.decryptString(jsonString(c, "login", "password")); err != nil || got != "n3w" {
+		t.Errorf("stored password: got %q, %v", got, err)
+	}
+	history, _ := c["passwordHistory"].([]any)
+	if len(history) != 1 {
+		t.Fatalf("expected 1 password history entry, got %v", history)
+	}
+	entry, _ := history[0].(map[string]any)
+	if got, _ := fake.itemKey.decryptString(jsonString(entry, "password")); got != "s3cret" {
+		t.Errorf("password history: got %q", got)
+	}
+
+	if err := m.Write(ctx, "bw://db/api token", "tok2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Write(ctx, "bw://db/new field", "added"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, "bw://db/api token"); got != "tok2" {
+		t.Errorf("Resolve custom field: got %q", got)
+	}
+	if got, _ := m.Resolve(ctx, "bw://db/new field"); got != "added" {
+		t.Errorf("Resolve added field: got %q", got)
+	}
+	if fields, _ := fake.ciphers["c1"]["fields"].([]any); len(fields) != 2 {
+		t.Errorf("expected 2 custom fields, got %d", len(fields))
+	}
+
+	// Rewriting the URI keeps its match rule
+	if err := m.Write(ctx, "bw://db/uri", "postgres://db2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, "bw://db/uri"); got != "postgres://db2" {
+		t.Errorf("Resolve URI: got %q", got)
+	}
+	login, _ := fake.ciphers["c1"]["login"].(map[string]any)
+	uris, _ := login["uris"].([]any)
+	if uri, _ := uris[0].(map[string]any); len(uris) != 1 || uri["match"] != float64(1) {
+		t.Errorf("URI match rule lost: %v", uris)
+	}
+
+	if err := m.Write(ctx, "bw://shared/notes", "org note"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := fake.orgKey.decryptString(jsonString(fake.ciphers["c2"], "notes")); got != "org note" {
+		t.Errorf("organization item should be encrypted with the organization key, got %q", got)
+	}
+
+	if err := m.Write(ctx, "bw://db/tls.crt", "x"); err == nil {
+		t.Error("expected writing an attachment to fail")
+	}
+	if err := m.Write(ctx, "bw://shared/password", "x"); err == nil {
+		t.Error("expected writing a login field of a note to fail")
+	}
+}
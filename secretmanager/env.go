@@ -0,0 +1,55 @@
+package secretmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvManager resolves env://VAR references from the daemon's environment.
+// Variables are read-only: changing them would only affect this process.
+type EnvManager struct {
+	secrets []string // configured secret references
+}
+
+func NewEnvManager(ctx context.Context, secrets []string) (*EnvManager, error) {
+	return &EnvManager{
+		secrets: secrets,
+	}, nil
+}
+
+func parseEnvReference(reference string) (string, error) {
+	if !strings.HasPrefix(reference, "env://") {
+		return "", fmt.Errorf("invalid reference format: must start with env://")
+	}
+	name := strings.TrimPrefix(reference, "env://")
+	if name == "" || strings.ContainsAny(name, "=/") {
+		return "", fmt.Errorf("invalid reference format: expected env://VARIABLE")
+	}
+	return name, nil
+}
+
+func (m *EnvManager) Resolve(ctx context.Context, reference string) (string, error) {
+	name, err := parseEnvReference(reference)
+	if err != nil {
+		return "", err
+	}
+	val, ok := os.LookupEnv(name)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", name)
+	}
+	return val, nil
+}
+
+func (m *EnvManager) Write(ctx context.Context, reference string, value string) error {
+	return fmt.Errorf("environment variables are read-only")
+}
+
+func (m *EnvManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *EnvManager) Name() string {
+	return "env"
+}
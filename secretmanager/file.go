@@ -0,0 +1,495 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileConfig configures the plaintext file provider
+type FileConfig struct {
+	BaseDir string // relative references are resolved against this directory
+}
+
+// FileManager resolves file://path[#key] references from plaintext files,
+// for local development and tests. Without a key the whole file is used.
+// Keys select a variable in dotenv files, or a key path (.a.b[0]) in JSON
+// and YAML files. Writes replace the file atomically, preserving the rest of
+// its contents.
+type FileManager struct {
+	baseDir string
+	secrets []string // configured secret references
+
+	mu sync.Mutex // serializes read-modify-write of files
+}
+
+func NewFileManager(ctx context.Context, secrets []string, cfg FileConfig) (*FileManager, error) {
+	return &FileManager{
+		baseDir: expandHome(cfg.BaseDir),
+		secrets: secrets,
+	}, nil
+}
+
+// parseFileReference extracts the path and optional key from "file:///path#key"
+func parseFileReference(reference string) (path, key string, err error) {
+	if !strings.HasPrefix(reference, "file://") {
+		return "", "", fmt.Errorf("invalid reference format: must start with file://")
+	}
+	path, key, _ = strings.Cut(strings.TrimPrefix(reference, "file://"), "#")
+	if path == "" {
+		return "", "", fmt.Errorf("invalid reference format: expected file:///path/to/file[#key]")
+	}
+	return path, key, nil
+}
+
+// fileFormat picks how keys are looked up in path
+func fileFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return "json"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "dotenv"
+}
+
+func (m *FileManager) Resolve(ctx context.Context, reference string) (string, error) {
+	path, key, err := parseFileReference(reference)
+	if err != nil {
+		return "", err
+	}
+	path = resolvePath(m.baseDir, path)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if key == "" {
+		return string(data), nil
+	}
+
+	if fileFormat(path) == "dotenv" {
+		for _, line := range parseDotenv(data) {
+			if line.key == key {
+				return line.value, nil
+			}
+		}
+		return "", fmt.Errorf("key %s not found in %s", key, path)
+	}
+
+	keys, err := parseKeyPath(key)
+	if err != nil {
+		return "", err
+	}
+	doc, err := parseYAMLDocument(data)
+	if err != nil {
+		return "", fmt.Errorf("parsing %s: %w", path, err)
+	}
+	node, err := walkNode(doc, keys, false)
+	if err != nil {
+		return "", fmt.Errorf("%s in %s", err, path)
+	}
+	return nodeString(node), nil
+}
+
+// nodeString returns a scalar's value, or maps and lists as compact JSON
+func nodeString(node *yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		if node.Tag == "!!null" {
+			return ""
+		}
+		return node.Value
+	}
+	var b bytes.Buffer
+	writeJSONNode(&b, node, "", "")
+	return b.String()
+}
+
+// ExtractKey returns the value at a key path such as ".db.password" or
+// "hosts[0]" in a JSON or YAML document. Maps and lists are returned as
+// compact JSON, and scalar reports whether the value was a plain scalar.
+func ExtractKey(data []byte, path string) (value string, scalar bool, err error) {
+	keys, err := parseKeyPath(path)
+	if err != nil {
+		return "", false, err
+	}
+	doc, err := parseYAMLDocument(data)
+	if err != nil {
+		return "", false, err
+	}
+	node, err := walkNode(doc, keys, false)
+	if err != nil {
+		return "", false, err
+	}
+	return nodeString(node), node.Kind == yaml.ScalarNode, nil
+}
+
+// SetKey sets the string at a key path in a JSON or YAML document, keeping
+// key order, indentation and comments.
+func SetKey(data []byte, path, value string) ([]byte, error) {
+	keys, err := parseKeyPath(path)
+	if err != nil {
+		return nil, err
+	}
+	trimmed := bytes.TrimSpace(data)
+	isJSON := len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[')
+	out, err := setYAMLKey(data, keys, value, isJSON)
+	if err != nil {
+		return nil, err
+	}
+	if isJSON && !bytes.HasSuffix(data, []byte("\n")) {
+		out = bytes.TrimSuffix(out, []byte("\n"))
+	}
+	return out, nil
+}
+
+func (m *FileManager) Write(ctx context.Context, reference string, value string) error {
+	path, key, err := parseFileReference(reference)
+	if err != nil {
+		return err
+	}
+	path = resolvePath(m.baseDir, path)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if key == "" {
+		return writeFileAtomic(path, []byte(value))
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	var out []byte
+	switch fileFormat(path) {
+	case "dotenv":
+		out = setDotenv(data, key, value)
+	case "json", "yaml":
+		keys, err := parseKeyPath(key)
+		if err != nil {
+			return err
+		}
+		if out, err = setYAMLKey(data, keys, value, fileFormat(path) == "json"); err != nil {
+			return fmt.Errorf("updating %s: %w", path, err)
+		}
+	}
+	return writeFileAtomic(path, out)
+}
+
+func (m *FileManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *FileManager) Name() string {
+	return "file"
+}
+
+// dotenvLine is a KEY=value assignment found in a dotenv file
+type dotenvLine struct {
+	key, value string
+	start, end int // byte range of the line, without its newline
+	export     bool
+}
+
+func parseDotenv(data []byte) []dotenvLine {
+	var lines []dotenvLine
+	start := 0
+	for start < len(data) {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			end = len(data)
+		} else {
+			end += start
+		}
+		line := strings.TrimSpace(strings.TrimSuffix(string(data[start:end]), "\r"))
+
+		export := false
+		if rest, ok := strings.CutPrefix(line, "export "); ok {
+			line, export = strings.TrimSpace(rest), true
+		}
+		if key, raw, ok := strings.Cut(line, "="); ok && !strings.HasPrefix(line, "#") {
+			lines = append(lines, dotenvLine{
+				key:    strings.TrimSpace(key),
+				value:  unquoteDotenv(strings.TrimSpace(raw)),
+				start:  start,
+				end:    end,
+				export: export,
+			})
+		}
+		start = end + 1
+	}
+	return lines
+}
+
+var dotenvEscapes = strings.NewReplacer(`\n`, "\n", `\r`, "\r", `\t`, "\t", `\"`, `"`, `\\`, `\`)
+
+func unquoteDotenv(raw string) string {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		for i := 1; i < len(raw); i++ {
+			if raw[i] == '\\' {
+				i++
+			} else if raw[i] == '"' {
+				return dotenvEscapes.Replace(raw[1:i])
+			}
+		}
+		return raw
+	case strings.HasPrefix(raw, "'"):
+		if end := strings.IndexByte(raw[1:], '\''); end >= 0 {
+			return raw[1 : end+1]
+		}
+		return raw
+	}
+	if i := strings.Index(raw, " #"); i >= 0 {
+		raw = raw[:i]
+	}
+	return strings.TrimSpace(raw)
+}
+
+var dotenvSafe = regexp.MustCompile(`^[A-Za-z0-9_./:@%+,=-]*$`)
+
+func quoteDotenv(value string) string {
+	switch {
+	case dotenvSafe.MatchString(value):
+		return value
+	case !strings.ContainsAny(value, "'\n\r"):
+		return "'" + value + "'"
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return `"` + r.Replace(value) + `"`
+}
+
+// setDotenv replaces the last assignment of key, or appends one
+func setDotenv(data []byte, key, value string) []byte {
+	lines := parseDotenv(data)
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := lines[i]
+		if line.key != key {
+			continue
+		}
+		assignment := key + "=" + quoteDotenv(value)
+		if line.export {
+			assignment = "export " + assignment
+		}
+		if bytes.HasSuffix(data[line.start:line.end], []byte("\r")) {
+			assignment += "\r"
+		}
+		out := append([]byte{}, data[:line.start]...)
+		out = append(out, assignment...)
+		return append(out, data[line.end:]...)
+	}
+
+	out := bytes.Clone(data)
+	if len(out) > 0 && !bytes.HasSuffix(out, []byte("\n")) {
+		out = append(out, '\n')
+	}
+	return append(out, key+"="+quoteDotenv(value)+"\n"...)
+}
+
+// parseYAMLDocument parses YAML or JSON into its root node, keeping key
+// order and comments for writing back
+func parseYAMLDocument(data []byte) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}, nil
+	}
+	return doc.Content[0], nil
+}
+
+// walkNode follows keys from node. With create, missing map keys are added.
+func walkNode(node *yaml.Node, keys []any, create bool) (*yaml.Node, error) {
+	for depth, k := range keys {
+		switch k := k.(type) {
+		case string:
+			if create && node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+				*node = yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			}
+			if node.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("%s is not a map", sopsTreePath(keys[:depth]))
+			}
+			var next *yaml.Node
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				if node.Content[i].Value == k {
+					next = node.Content[i+1]
+				}
+			}
+			if next == nil {
+				if !create {
+					return nil, fmt.Errorf("key %s not found", sopsTreePath(keys[:depth+1]))
+				}
+				next = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null"}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: k}, next)
+			}
+			node = next
+		case int:
+			if node.Kind != yaml.SequenceNode {
+				return nil, fmt.Errorf("%s is not a list", sopsTreePath(keys[:depth]))
+			}
+			if k < 0 || k >= len(node.Content) {
+				return nil, fmt.Errorf("index %s out of range", sopsTreePath(keys[:depth+1]))
+			}
+			node = node.Content[k]
+		}
+	}
+	return node, nil
+}
+
+// setYAMLKey sets the string at keys and re-encodes the document in its
+// original format and indentation
+func setYAMLKey(data []byte, keys []any, value string, isJSON bool) ([]byte, error) {
+	root, err := parseYAMLDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	node, err := walkNode(root, keys, true)
+	if err != nil {
+		return nil, err
+	}
+	style := yaml.Style(0)
+	if strings.Contains(value, "\n") {
+		style = yaml.LiteralStyle
+	}
+	*node = yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value, Style: style, LineComment: node.LineComment}
+
+	indent := detectIndent(data)
+	var b bytes.Buffer
+	if isJSON {
+		if bytes.Contains(bytes.TrimSpace(data), []byte("\n")) || len(bytes.TrimSpace(data)) == 0 {
+			writeJSONNode(&b, root, "\n", strings.Repeat(" ", indent))
+		} else {
+			writeJSONNode(&b, root, "", "")
+		}
+		b.WriteByte('\n')
+		return b.Bytes(), nil
+	}
+
+	enc := yaml.NewEncoder(&b)
+	enc.SetIndent(indent)
+	if err := enc.Encode(root); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), enc.Close()
+}
+
+// detectIndent returns the indentation of the first indented line, or 2
+func detectIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		if trimmed := strings.TrimLeft(line, " "); trimmed != line && trimmed != "" {
+			return len(line) - len(trimmed)
+		}
+	}
+	return 2
+}
+
+// writeJSONNode encodes a YAML node tree as JSON, keeping key order. An
+// empty newline writes compact JSON.
+func writeJSONNode(b *bytes.Buffer, node *yaml.Node, newline, indent string) {
+	writeJSONValue(b, node, newline, indent, newline)
+}
+
+func writeJSONValue(b *bytes.Buffer, node *yaml.Node, newline, indent, prefix string) {
+	inner := prefix + indent
+	sep := ","
+	if newline == "" {
+		sep, inner, prefix = ",", "", ""
+	}
+	switch node.Kind {
+	case yaml.AliasNode:
+		writeJSONValue(b, node.Alias, newline, indent, prefix)
+	case yaml.MappingNode:
+		if len(node.Content) == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteString("{")
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if i > 0 {
+				b.WriteString(sep)
+			}
+			b.WriteString(inner)
+			writeJSONString(b, node.Content[i].Value)
+			b.WriteString(":")
+			if newline != "" {
+				b.WriteString(" ")
+			}
+			writeJSONValue(b, node.Content[i+1], newline, indent, inner)
+		}
+		b.WriteString(prefix + "}")
+	case yaml.SequenceNode:
+		if len(node.Content) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteString("[")
+		for i, item := range node.Content {
+			if i > 0 {
+				b.WriteString(sep)
+			}
+			b.WriteString(inner)
+			writeJSONValue(b, item, newline, indent, inner)
+		}
+		b.WriteString(prefix + "]")
+	default:
+		switch node.Tag {
+		case "!!null":
+			b.WriteString("null")
+		case "!!bool":
+			b.WriteString(strconv.FormatBool(node.Value == "true"))
+		case "!!int", "!!float":
+			writeJSONNumber(b, node)
+		default:
+			writeJSONString(b, node.Value)
+		}
+	}
+}
+
+var jsonNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// writeJSONNumber writes a YAML number as JSON. Forms JSON lacks, such as
+// 0x1F or +12, are normalized; .inf and .nan have no JSON number, so they
+// become strings.
+func writeJSONNumber(b *bytes.Buffer, node *yaml.Node) {
+	if jsonNumber.MatchString(node.Value) {
+		b.WriteString(node.Value)
+		return
+	}
+	var n any
+	if err := node.Decode(&n); err == nil {
+		switch n := n.(type) {
+		case int:
+			b.WriteString(strconv.Itoa(n))
+			return
+		case uint64:
+			b.WriteString(strconv.FormatUint(n, 10))
+			return
+		case float64:
+			if !math.IsInf(n, 0) && !math.IsNaN(n) {
+				b.WriteString(strconv.FormatFloat(n, 'g', -1, 64))
+				return
+			}
+		}
+	}
+	writeJSONString(b, node.Value)
+}
+
+func writeJSONString(b *bytes.Buffer, s string) {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	b.Truncate(b.Len() - 1) // Encode appends a newline
+}
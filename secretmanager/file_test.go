@@ -0,0 +1,209 @@
+package secretmanager_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/evict/secrets-fuse/secretmanager"
+	"github.com/evict/secrets-fuse/secretmanager/secretmanagertest"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestFileManagerConformance(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.json"), `{"db": {"password": "x"}, "port": 5432}`+"\n")
+
+	refs := []string{
+		"file://plain.txt",
+		"file://.env#API_KEY",
+		"file://.env#OTHER",
+		"file://config.json#.db.password",
+		"file://config.json#.db.user",
+		"file://config.yaml#.a.b",
+	}
+	m, err := secretmanager.NewFileManager(context.Background(), refs, secretmanager.FileConfig{BaseDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secretmanagertest.Run(t, m, refs...)
+}
+
+func TestFileManagerDotenv(t *testing.T) {
+	dir := t.TempDir()
+	env := filepath.Join(dir, "app.env")
+	writeFile(t, env, `# database
+DB_HOST=localhost
+export DB_PASSWORD="p@ss \"word\"\n2"
+SINGLE='it''s $HOME' # comment
+PLAIN=value # comment
+EMPTY=
+`)
+	ctx := context.Background()
+	m, _ := secretmanager.NewFileManager(ctx, nil, secretmanager.FileConfig{})
+
+	for key, want := range map[string]string{
+		"DB_HOST":     "localhost",
+		"DB_PASSWORD": "p@ss \"word\"\n2",
+		"SINGLE":      "it",
+		"PLAIN":       "value",
+		"EMPTY":       "",
+	} {
+		if got, err := m.Resolve(ctx, "file://"+env+"#"+key); err != nil || got != want {
+			t.Errorf("%s: got %q, %v; want %q", key, got, err, want)
+		}
+	}
+	if _, err := m.Resolve(ctx, "file://"+env+"#MISSING"); err == nil {
+		t.Error("expected missing key to fail")
+	}
+
+	if err := m.Write(ctx, "file://"+env+"#DB_PASSWORD", "new secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Write(ctx, "file://"+env+"#ADDED", "a$b"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# database
+DB_HOST=localhost
+export DB_PASSWORD='new secret'
+SINGLE='it''s $HOME' # comment
+PLAIN=value # comment
+EMPTY=
+ADDED='a$b'
+`
+	if got := readFile(t, env); got != want {
+		t.Errorf("file after writes:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestFileManagerWriteThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "dotfiles", "app.env")
+	if err := os.Mkdir(filepath.Dir(target), 0700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, target, "TOKEN=old\n")
+	link := filepath.Join(dir, ".env")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	m, _ := secretmanager.NewFileManager(ctx, nil, secretmanager.FileConfig{})
+	if err := m.Write(ctx, "file://"+link+"#TOKEN", "new"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("symlink was replaced: %v, %v", info, err)
+	}
+	if got := readFile(t, target); got != "TOKEN=new\n" {
+		t.Errorf("target after write: %q", got)
+	}
+}
+
+func TestFileManagerStructured(t *testing.T) {
+	dir := t.TempDir()
+	jsonFile := filepath.Join(dir, "secret.json")
+	writeFile(t, jsonFile, `{
+    "z": {"token": "abc", "hosts": ["a", "b"]},
+    "a": 1,
+    "html": "<b>"
+}
+`)
+	yamlFile := filepath.Join(dir, "secret.yml")
+	writeFile(t, yamlFile, `# app secrets
+db:
+  password: hunter2 # rotate monthly
+  port: 5432
+`)
+	numbersFile := filepath.Join(dir, "numbers.yaml")
+	writeFile(t, numbersFile, "mode: 0x1F\nperm: 0o644\nratio: +1.5\nmax: .inf\n")
+	ctx := context.Background()
+	m, _ := secretmanager.NewFileManager(ctx, nil, secretmanager.FileConfig{})
+
+	for ref, want := range map[string]string{
+		"file://" + jsonFile + "#.z.token":     "abc",
+		"file://" + jsonFile + "#z.hosts[1]":   "b",
+		"file://" + jsonFile + "#.z.hosts":     `["a","b"]`,
+		"file://" + yamlFile + "#.db.password": "hunter2",
+		"file://" + yamlFile + "#.db.port":     "5432",
+		// JSON has no hex, octal or infinity
+		"file://" + numbersFile + "#.": `{"mode":31,"perm":420,"ratio":1.5,"max":".inf"}`,
+	} {
+		if got, err := m.Resolve(ctx, ref); err != nil || got != want {
+			t.Errorf("%s: got %q, %v; want %q", ref, got, err, want)
+		}
+	}
+	for _, ref := range []string{"file://" + jsonFile + "#.nope", "file://" + jsonFile + "#.z.hosts[5]", "file://" + jsonFile + "#.a.b"} {
+		if _, err := m.Resolve(ctx, ref); err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+
+	// Writes keep key order, indentation and comments
+	if err := m.Write(ctx, "file://"+jsonFile+"#.z.token", "xyz"); err != nil {
+		t.Fatal(err)
+	}
+	want := `{
+    "z": {
+        "token": "xyz",
+        "hosts": [
+            "a",
+            "b"
+        ]
+    },
+    "a": 1,
+    "html": "<b>"
+}
+`
+	if got := readFile(t, jsonFile); got != want {
+		t.Errorf("JSON after write:\n%s\nwant:\n%s", got, want)
+	}
+
+	if err := m.Write(ctx, "file://"+yamlFile+"#.db.password", "12345"); err != nil {
+		t.Fatal(err)
+	}
+	want = `# app secrets
+db:
+  password: "12345" # rotate monthly
+  port: 5432
+`
+	if got := readFile(t, yamlFile); got != want {
+		t.Errorf("YAML after write:\n%s\nwant:\n%s", got, want)
+	}
+	if got, _ := m.Resolve(ctx, "file://"+yamlFile+"#.db.password"); got != "12345" {
+		t.Errorf("Resolve after write: got %q", got)
+	}
+}
+
+func TestEnvManager(t *testing.T) {
+	t.Setenv("SECRETS_FUSE_TEST_VAR", "from-env")
+	ctx := context.Background()
+	m, _ := secretmanager.NewEnvManager(ctx, nil)
+
+	if got, err := m.Resolve(ctx, "env://SECRETS_FUSE_TEST_VAR"); err != nil || got != "from-env" {
+		t.Errorf("Resolve: got %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "env://SECRETS_FUSE_TEST_UNSET"); err == nil {
+		t.Error("expected unset variable to fail")
+	}
+	if err := m.Write(ctx, "env://SECRETS_FUSE_TEST_VAR", "x"); err == nil {
+		t.Error("expected write to fail")
+	}
+}
@@ -0,0 +1,220 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+)
+
+// GCPSecretManagerConfig configures access to Google Cloud Secret Manager.
+// Without a token, application default credentials are used
+// (GOOGLE_APPLICATION_CREDENTIALS, gcloud login or the metadata server).
+type GCPSecretManagerConfig struct {
+	Endpoint  string // defaults to https://secretmanager.googleapis.com
+	Token     string // static OAuth access token
+	TokenFile string
+}
+
+// GCPSecretManager resolves gcpsm://projects/P/secrets/S[/versions/V]
+// references through the Secret Manager REST API.
+type GCPSecretManager struct {
+	endpoint string
+	tokens   oauth2.TokenSource
+	http     *http.Client
+	secrets  []string // configured secret references
+}
+
+func NewGCPSecretManager(ctx context.Context, secrets []string, cfg GCPSecretManagerConfig) (*GCPSecretManager, error) {
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+
+	token := cfg.Token
+	if token == "" && cfg.TokenFile != "" {
+		var err error
+		if token, err = readTokenFile(cfg.TokenFile); err != nil {
+			return nil, err
+		}
+	}
+
+	var tokens oauth2.TokenSource
+	if token != "" {
+		tokens = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	} else {
+		creds, err := google.FindDefaultCredentials(ctx, "https://www.googleapis.com/auth/cloud-platform")
+		if err != nil {
+			return nil, fmt.Errorf("finding Google credentials: %w", err)
+		}
+		tokens = creds.TokenSource
+	}
+
+	return &GCPSecretManager{
+		endpoint: strings.TrimRight(endpoint, "/"),
+		tokens:   tokens,
+		http:     &http.Client{Timeout: 30 * time.Second},
+		secrets:  secrets,
+	}, nil
+}
+
+// gcpAPIError is the error body returned by Google APIs
+type gcpAPIError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+func (e *gcpAPIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.Code, e.Status, e.Message)
+}
+
+// do sends a request to the Secret Manager API and decodes the JSON response into out
+func (m *GCPSecretManager) do(ctx context.Context, method, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, m.endpoint+path, reqBody)
+	if err != nil {
+		return err
+	}
+	token, err := m.tokens.Token()
+	if err != nil {
+		return fmt.Errorf("getting access token: %w", err)
+	}
+	token.SetAuthHeader(req)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Error gcpAPIError `json:"error"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		if apiErr.Error.Code == 0 {
+			apiErr.Error.Code, apiErr.Error.Status = resp.StatusCode, resp.Status
+		}
+		return &apiErr.Error
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// parseGCPReference extracts the secret resource name and version from
+// "gcpsm://projects/p/secrets/s[/versions/v]"
+func parseGCPReference(reference string) (secret, version string, err error) {
+	if !strings.HasPrefix(reference, "gcpsm://") {
+		return "", "", fmt.Errorf("invalid reference format: must start with gcpsm://")
+	}
+	parts := strings.Split(strings.TrimPrefix(reference, "gcpsm://"), "/")
+	valid := (len(parts) == 4 || len(parts) == 6) && parts[0] == "projects" && parts[2] == "secrets" &&
+		parts[1] != "" && parts[3] != "" && (len(parts) == 4 || parts[4] == "versions" && parts[5] != "")
+	if !valid {
+		return "", "", fmt.Errorf("invalid reference format: expected gcpsm://projects/<project>/secrets/<secret>[/versions/<version>]")
+	}
+	version = "latest"
+	if len(parts) == 6 {
+		version = parts[5]
+	}
+	return strings.Join(parts[:4], "/"), version, nil
+}
+
+type gcpPayload struct {
+	Data       string `json:"data"`
+	DataCRC32C string `json:"dataCrc32c,omitempty"`
+}
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+func (m *GCPSecretManager) Resolve(ctx context.Context, reference string) (string, error) {
+	secret, version, err := parseGCPReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Payload gcpPayload `json:"payload"`
+	}
+	if err := m.do(ctx, http.MethodGet, "/v1/"+secret+"/versions/"+url.PathEscape(version)+":access", nil, &resp); err != nil {
+		return "", fmt.Errorf("failed to access %s version %s: %w", secret, version, err)
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("decoding payload of %s: %w", secret, err)
+	}
+	if resp.Payload.DataCRC32C != "" {
+		if want, err := strconv.ParseUint(resp.Payload.DataCRC32C, 10, 32); err == nil && crc32.Checksum(data, castagnoli) != uint32(want) {
+			return "", fmt.Errorf("payload of %s failed its checksum", secret)
+		}
+	}
+	return string(data), nil
+}
+
+// Write adds a new version to the secret, creating the secret with automatic
+// replication if it does not exist. Older versions stay enabled.
+func (m *GCPSecretManager) Write(ctx context.Context, reference string, value string) error {
+	secret, version, err := parseGCPReference(reference)
+	if err != nil {
+		return err
+	}
+	if version != "latest" {
+		return fmt.Errorf("cannot write to %s: reference is pinned to version %s", secret, version)
+	}
+
+	payload := map[string]any{"payload": gcpPayload{
+		Data:       base64.StdEncoding.EncodeToString([]byte(value)),
+		DataCRC32C: strconv.FormatUint(uint64(crc32.Checksum([]byte(value), castagnoli)), 10),
+	}}
+
+	err = m.do(ctx, http.MethodPost, "/v1/"+secret+":addVersion", payload, nil)
+	var apiErr *gcpAPIError
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+		project, secretID, _ := strings.Cut(strings.TrimPrefix(secret, "projects/"), "/secrets/")
+		create := map[string]any{"replication": map[string]any{"automatic": map[string]any{}}}
+		if err := m.do(ctx, http.MethodPost, "/v1/projects/"+project+"/secrets?secretId="+url.QueryEscape(secretID), create, nil); err != nil {
+			return fmt.Errorf("failed to create %s: %w", secret, err)
+		}
+		err = m.do(ctx, http.MethodPost, "/v1/"+secret+":addVersion", payload, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to add version to %s: %w", secret, err)
+	}
+	return nil
+}
+
+func (m *GCPSecretManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *GCPSecretManager) Name() string {
+	return "gcpsm"
+}
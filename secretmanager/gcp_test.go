@@ -0,0 +1,153 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeGCP emulates the Secret Manager REST endpoints the manager uses
+type fakeGCP struct {
+	mu       sync.Mutex
+	versions map[string][]string // "projects/p/secrets/s" -> payloads, version n at index n-1
+	corrupt  bool                // send a wrong checksum
+}
+
+func (f *fakeGCP) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fail := func(code int, status string) {
+		w.WriteHeader(code)
+		fmt.Fprintf(w, `{"error":{"code":%d,"message":"fake","status":%q}}`, code, status)
+	}
+	if r.Header.Get("Authorization") != "Bearer test-token" {
+		fail(http.StatusUnauthorized, "UNAUTHENTICATED")
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case r.Method == http.MethodGet && strings.HasSuffix(path, ":access"):
+		secret, version, _ := strings.Cut(strings.TrimSuffix(path, ":access"), "/versions/")
+		versions := f.versions[secret]
+		n := len(versions)
+		if version != "latest" {
+			n, _ = strconv.Atoi(version)
+		}
+		if n < 1 || n > len(versions) {
+			fail(http.StatusNotFound, "NOT_FOUND")
+			return
+		}
+		data := []byte(versions[n-1])
+		crc := crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))
+		if f.corrupt {
+			crc++
+		}
+		json.NewEncoder(w).Encode(map[string]any{"payload": map[string]string{
+			"data":       base64.StdEncoding.EncodeToString(data),
+			"dataCrc32c": strconv.FormatUint(uint64(crc), 10),
+		}})
+	case r.Method == http.MethodPost && strings.HasSuffix(path, ":addVersion"):
+		secret := strings.TrimSuffix(path, ":addVersion")
+		if _, ok := f.versions[secret]; !ok {
+			fail(http.StatusNotFound, "NOT_FOUND")
+			return
+		}
+		var req struct{ Payload gcpPayload }
+		json.NewDecoder(r.Body).Decode(&req)
+		data, _ := base64.StdEncoding.DecodeString(req.Payload.Data)
+		f.versions[secret] = append(f.versions[secret], string(data))
+		fmt.Fprint(w, `{}`)
+	case r.Method == http.MethodPost && strings.HasSuffix(path, "/secrets"):
+		secret := path + "/" + r.URL.Query().Get("secretId")
+		if _, ok := f.versions[secret]; ok {
+			fail(http.StatusConflict, "ALREADY_EXISTS")
+			return
+		}
+		f.versions[secret] = nil
+		fmt.Fprint(w, `{}`)
+	default:
+		fail(http.StatusNotFound, "NOT_FOUND")
+	}
+}
+
+func TestParseGCPReference(t *testing.T) {
+	tests := []struct {
+		ref, secret, version string
+		wantErr              bool
+	}{
+		{ref: "gcpsm://projects/p/secrets/db/versions/latest", secret: "projects/p/secrets/db", version: "latest"},
+		{ref: "gcpsm://projects/p/secrets/db/versions/3", secret: "projects/p/secrets/db", version: "3"},
+		{ref: "gcpsm://projects/p/secrets/db", secret: "projects/p/secrets/db", version: "latest"},
+		{ref: "gcpsm://projects/p/secrets/db/versions/", wantErr: true},
+		{ref: "gcpsm://projects/p/db", wantErr: true},
+		{ref: "gcpsm://p/secrets/db", wantErr: true},
+	}
+	for _, tt := range tests {
+		secret, version, err := parseGCPReference(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if secret != tt.secret || version != tt.version {
+			t.Errorf("%s: got %q %q", tt.ref, secret, version)
+		}
+	}
+}
+
+func TestGCPSecretManager(t *testing.T) {
+	fake := &fakeGCP{versions: map[string][]string{"projects/p/secrets/db": {"v1", "v2"}}}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+	ctx := context.Background()
+
+	m, err := NewGCPSecretManager(ctx, nil, GCPSecretManagerConfig{Endpoint: srv.URL, Token: "test-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := m.Resolve(ctx, "gcpsm://projects/p/secrets/db/versions/latest"); err != nil || got != "v2" {
+		t.Errorf("Resolve latest: got %q, %v", got, err)
+	}
+	if got, err := m.Resolve(ctx, "gcpsm://projects/p/secrets/db/versions/1"); err != nil || got != "v1" {
+		t.Errorf("Resolve pinned: got %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "gcpsm://projects/p/secrets/missing"); err == nil {
+		t.Error("expected missing secret to fail")
+	}
+
+	if err := m.Write(ctx, "gcpsm://projects/p/secrets/db/versions/latest", "v3"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.versions["projects/p/secrets/db"]); n != 3 {
+		t.Errorf("expected a third version, got %d", n)
+	}
+	if got, _ := m.Resolve(ctx, "gcpsm://projects/p/secrets/db/versions/1"); got != "v1" {
+		t.Errorf("older version should stay accessible, got %q", got)
+	}
+	if err := m.Write(ctx, "gcpsm://projects/p/secrets/db/versions/1", "x"); err == nil {
+		t.Error("expected write to a pinned version to fail")
+	}
+
+	// Missing secrets are created before adding the version
+	if err := m.Write(ctx, "gcpsm://projects/p/secrets/new", "fresh"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, "gcpsm://projects/p/secrets/new"); got != "fresh" {
+		t.Errorf("Resolve created secret: got %q", got)
+	}
+
+	fake.corrupt = true
+	if _, err := m.Resolve(ctx, "gcpsm://projects/p/secrets/db"); err == nil {
+		t.Error("expected checksum mismatch to fail")
+	}
+}
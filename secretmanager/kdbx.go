@@ -0,0 +1,339 @@
+package secretmanager
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+// KDBXConfig configures access to a KeePass database. At least one of
+// PasswordFile, PasswordEnv or KeyFile must be set.
+type KDBXConfig struct {
+	Path         string
+	PasswordFile string
+	PasswordEnv  string // name of an environment variable holding the password
+	KeyFile      string
+}
+
+// KDBXManager resolves kdbx://Group/Entry/Field references from a local
+// KDBX 3.1/4 database, reloading it whenever the file changes on disk.
+type KDBXManager struct {
+	path        string
+	credentials *gokeepasslib.DBCredentials
+
+	mu      sync.Mutex
+	db      *gokeepasslib.Database
+	modTime time.Time
+	size    int64
+}
+
+func NewKDBXManager(ctx context.Context, cfg KDBXConfig) (*KDBXManager, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("no kdbx database path configured")
+	}
+
+	password := ""
+	hasPassword := false
+	switch {
+	case cfg.PasswordFile != "":
+		var err error
+		if password, err = readTokenFile(cfg.PasswordFile); err != nil {
+			return nil, err
+		}
+		hasPassword = true
+	case cfg.PasswordEnv != "":
+		password, hasPassword = os.LookupEnv(cfg.PasswordEnv)
+		if !hasPassword {
+			return nil, fmt.Errorf("environment variable %s is not set", cfg.PasswordEnv)
+		}
+	}
+
+	var (
+		creds *gokeepasslib.DBCredentials
+		err   error
+	)
+	keyFile := expandHome(cfg.KeyFile)
+	switch {
+	case hasPassword && keyFile != "":
+		creds, err = gokeepasslib.NewPasswordAndKeyCredentials(password, keyFile)
+	case keyFile != "":
+		creds, err = gokeepasslib.NewKeyCredentials(keyFile)
+	case hasPassword:
+		creds = gokeepasslib.NewPasswordCredentials(password)
+	default:
+		return nil, fmt.Errorf("no kdbx credentials configured (password_file, password_env or key_file)")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loading kdbx key file: %w", err)
+	}
+
+	m := &KDBXManager{
+		path:        expandHome(cfg.Path),
+		credentials: creds,
+	}
+
+	// Fail early on a wrong password or unreadable database
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// load (re)reads the database if it changed on disk since it was last loaded.
+// Must be called with m.mu held.
+func (m *KDBXManager) load() error {
+	info, err := os.Stat(m.path)
+	if err != nil {
+		return fmt.Errorf("opening kdbx database: %w", err)
+	}
+	if m.db != nil && info.ModTime().Equal(m.modTime) && info.Size() == m.size {
+		return nil
+	}
+
+	f, err := os.Open(m.path)
+	if err != nil {
+		return fmt.Errorf("opening kdbx database: %w", err)
+	}
+	defer f.Close()
+
+	db := gokeepasslib.NewDatabase()
+	db.Credentials = m.credentials
+	if err := gokeepasslib.NewDecoder(f).Decode(db); err != nil {
+		return fmt.Errorf("decoding kdbx database %s: %w", m.path, err)
+	}
+	if err := db.UnlockProtectedEntries(); err != nil {
+		return fmt.Errorf("unlocking kdbx database: %w", err)
+	}
+
+	m.db = db
+	m.modTime = info.ModTime()
+	m.size = info.Size()
+	return nil
+}
+
+// parseKDBXReference splits "kdbx://Group/Sub/Entry/Field" into groups, entry and field
+func parseKDBXReference(reference string) (groups []string, entry, field string, err error) {
+	if !strings.HasPrefix(reference, "kdbx://") {
+		return nil, "", "", fmt.Errorf("invalid reference format: must start with kdbx://")
+	}
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(reference, "kdbx://"), "/"), "/")
+	if len(parts) < 2 || parts[len(parts)-1] == "" || parts[len(parts)-2] == "" {
+		return nil, "", "", fmt.Errorf("invalid reference format: expected kdbx://Group/Entry/Field")
+	}
+	return parts[:len(parts)-2], parts[len(parts)-2], parts[len(parts)-1], nil
+}
+
+// findEntry walks groups from the database root and returns the named entry
+func (m *KDBXManager) findEntry(groups []string, title string) (*gokeepasslib.Entry, error) {
+	if len(m.db.Content.Root.Groups) == 0 {
+		return nil, fmt.Errorf("database has no root group")
+	}
+	group := &m.db.Content.Root.Groups[0]
+
+	for _, name := range groups {
+		var next *gokeepasslib.Group
+		for i := range group.Groups {
+			if group.Groups[i].Name == name {
+				next = &group.Groups[i]
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("group %q not found", name)
+		}
+		group = next
+	}
+
+	for i := range group.Entries {
+		if group.Entries[i].GetTitle() == title {
+			return &group.Entries[i], nil
+		}
+	}
+	return nil, fmt.Errorf("entry %q not found", title)
+}
+
+// findValue returns the entry string matching field, preferring an exact match
+func findValue(entry *gokeepasslib.Entry, field string) *gokeepasslib.ValueData {
+	if v := entry.Get(field); v != nil {
+		return v
+	}
+	for i := range entry.Values {
+		if strings.EqualFold(entry.Values[i].Key, field) {
+			return &entry.Values[i]
+		}
+	}
+	return nil
+}
+
+func findBinaryRef(entry *gokeepasslib.Entry, name string) *gokeepasslib.BinaryReference {
+	for i := range entry.Binaries {
+		if entry.Binaries[i].Name == name {
+			return &entry.Binaries[i]
+		}
+	}
+	return nil
+}
+
+func (m *KDBXManager) Resolve(ctx context.Context, reference string) (string, error) {
+	groups, title, field, err := parseKDBXReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		return "", err
+	}
+
+	entry, err := m.findEntry(groups, title)
+	if err != nil {
+		return "", err
+	}
+
+	if v := findValue(entry, field); v != nil {
+		return v.Value.Content, nil
+	}
+
+	// Attachments are exposed by file name
+	if ref := findBinaryRef(entry, field); ref != nil {
+		binary := m.db.FindBinary(ref.Value.ID)
+		if binary == nil {
+			return "", fmt.Errorf("attachment %q is missing from the database", field)
+		}
+		return binary.GetContentString()
+	}
+
+	return "", fmt.Errorf("field %q not found in entry %q", field, title)
+}
+
+func (m *KDBXManager) Write(ctx context.Context, reference string, value string) error {
+	groups, title, field, err := parseKDBXReference(reference)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		return err
+	}
+
+	entry, err := m.findEntry(groups, title)
+	if err != nil {
+		return err
+	}
+
+	// Keep the previous version in the entry history, as KeePass does
+	previous := *entry
+	previous.Histories = nil
+	previous.Values = append([]gokeepasslib.ValueData(nil), entry.Values...)
+	previous.Binaries = append([]gokeepasslib.BinaryReference(nil), entry.Binaries...)
+	if len(entry.Histories) == 0 {
+		entry.Histories = []gokeepasslib.History{{}}
+	}
+	entry.Histories[0].Entries = append(entry.Histories[0].Entries, previous)
+
+	if v := findValue(entry, field); v != nil {
+		v.Value.Content = value
+	} else if ref := findBinaryRef(entry, field); ref != nil {
+		ref.Value.ID = m.db.AddBinary([]byte(value)).ID
+	} else {
+		entry.Values = append(entry.Values, gokeepasslib.ValueData{
+			Key:   field,
+			Value: gokeepasslib.V{Content: value, Protected: w.NewBoolWrapper(true)},
+		})
+	}
+	now := w.Now()
+	entry.Times.LastModificationTime = &now
+
+	return m.save()
+}
+
+// save encodes the database to a temporary file and renames it over the original.
+// The in-memory copy is locked by encoding, so it is dropped and reloaded on next use.
+// Must be called with m.mu held.
+func (m *KDBXManager) save() error {
+	defer func() { m.db = nil }()
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.path), "."+filepath.Base(m.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("writing kdbx database: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	// The encoder expects protected values to be locked, as they are after decoding
+	if err := m.db.LockProtectedEntries(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("locking kdbx database: %w", err)
+	}
+	if err := gokeepasslib.NewEncoder(tmp).Encode(m.db); err != nil {
+		tmp.Close()
+		return fmt.Errorf("encoding kdbx database: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("writing kdbx database: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("writing kdbx database: %w", err)
+	}
+
+	if info, err := os.Stat(m.path); err == nil {
+		os.Chmod(tmp.Name(), info.Mode().Perm())
+	}
+	if err := os.Rename(tmp.Name(), m.path); err != nil {
+		return fmt.Errorf("replacing kdbx database: %w", err)
+	}
+	return nil
+}
+
+// ListSecrets returns a reference for every string field and attachment in the database
+func (m *KDBXManager) ListSecrets(ctx context.Context) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	if len(m.db.Content.Root.Groups) == 0 {
+		return nil, nil
+	}
+
+	var refs []string
+	var walk func(g *gokeepasslib.Group, path string)
+	walk = func(g *gokeepasslib.Group, path string) {
+		for _, e := range g.Entries {
+			prefix := "kdbx://" + path + e.GetTitle() + "/"
+			for _, v := range e.Values {
+				if v.Key != "Title" {
+					refs = append(refs, prefix+v.Key)
+				}
+			}
+			for _, b := range e.Binaries {
+				refs = append(refs, prefix+b.Name)
+			}
+		}
+		for i := range g.Groups {
+			walk(&g.Groups[i], path+g.Groups[i].Name+"/")
+		}
+	}
+	walk(&m.db.Content.Root.Groups[0], "")
+	return refs, nil
+}
+
+func (m *KDBXManager) Name() string {
+	return "kdbx"
+}
@@ -0,0 +1,161 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/tobischo/gokeepasslib/v3"
+	w "github.com/tobischo/gokeepasslib/v3/wrappers"
+)
+
+// writeTestKDBX creates a database with Root/Servers/Web holding a password and an attachment
+func writeTestKDBX(t *testing.T, path, password string, options ...gokeepasslib.DatabaseOption) {
+	t.Helper()
+
+	db := gokeepasslib.NewDatabase(options...)
+	db.Credentials = gokeepasslib.NewPasswordCredentials(password)
+
+	entry := gokeepasslib.NewEntry()
+	entry.Values = append(entry.Values,
+		gokeepasslib.ValueData{Key: "Title", Value: gokeepasslib.V{Content: "Web"}},
+		gokeepasslib.ValueData{Key: "UserName", Value: gokeepasslib.V{Content: "admin"}},
+		gokeepasslib.ValueData{Key: "Password", Value: gokeepasslib.V{Content: "hunter2", Protected: w.NewBoolWrapper(true)}},
+	)
+	binary := db.AddBinary([]byte("-----BEGIN CERTIFICATE-----"))
+	entry.Binaries = append(entry.Binaries, binary.CreateReference("tls.crt"))
+
+	servers := gokeepasslib.NewGroup()
+	servers.Name = "Servers"
+	servers.Entries = append(servers.Entries, entry)
+
+	root := gokeepasslib.NewGroup()
+	root.Name = "Root"
+	root.Groups = append(root.Groups, servers)
+	db.Content.Root = &gokeepasslib.RootData{Groups: []gokeepasslib.Group{root}}
+
+	if err := db.LockProtectedEntries(); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := gokeepasslib.NewEncoder(f).Encode(db); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestKDBXResolveAndWrite(t *testing.T) {
+	versions := map[string]gokeepasslib.DatabaseOption{
+		"kdbx3.1": gokeepasslib.WithDatabaseKDBXVersion3(),
+		"kdbx4":   gokeepasslib.WithDatabaseKDBXVersion4(),
+	}
+	for name, version := range versions {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			dbPath := filepath.Join(dir, "test.kdbx")
+			writeTestKDBX(t, dbPath, "master", version)
+
+			t.Setenv("TEST_KDBX_PASSWORD", "master")
+			ctx := context.Background()
+			m, err := NewKDBXManager(ctx, KDBXConfig{Path: dbPath, PasswordEnv: "TEST_KDBX_PASSWORD"})
+			if err != nil {
+				t.Fatalf("NewKDBXManager: %v", err)
+			}
+
+			tests := map[string]string{
+				"kdbx://Servers/Web/Password": "hunter2",
+				"kdbx://Servers/Web/username": "admin",
+				"kdbx://Servers/Web/tls.crt":  "-----BEGIN CERTIFICATE-----",
+			}
+			for ref, want := range tests {
+				if got, err := m.Resolve(ctx, ref); err != nil || got != want {
+					t.Errorf("Resolve(%s): got %q, %v; want %q", ref, got, err, want)
+				}
+			}
+
+			if err := m.Write(ctx, "kdbx://Servers/Web/Password", "correct-horse"); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			if err := m.Write(ctx, "kdbx://Servers/Web/tls.crt", "new-cert"); err != nil {
+				t.Fatalf("Write attachment: %v", err)
+			}
+
+			// A fresh manager must see the changes on disk
+			m2, err := NewKDBXManager(ctx, KDBXConfig{Path: dbPath, PasswordEnv: "TEST_KDBX_PASSWORD"})
+			if err != nil {
+				t.Fatalf("reopen: %v", err)
+			}
+			if got, _ := m2.Resolve(ctx, "kdbx://Servers/Web/Password"); got != "correct-horse" {
+				t.Errorf("password after write: got %q", got)
+			}
+			if got, _ := m2.Resolve(ctx, "kdbx://Servers/Web/tls.crt"); got != "new-cert" {
+				t.Errorf("attachment after write: got %q", got)
+			}
+
+			entry, err := m2.findEntry([]string{"Servers"}, "Web")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entry.Histories) == 0 || len(entry.Histories[0].Entries) != 2 {
+				t.Errorf("expected two history entries, got %+v", entry.Histories)
+			}
+
+			if _, err := NewKDBXManager(ctx, KDBXConfig{Path: dbPath, PasswordEnv: "NO_SUCH_VAR_FOR_KDBX"}); err == nil {
+				t.Error("expected missing password variable to fail")
+			}
+		})
+	}
+}
+
+func TestKDBXReloadAndList(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "test.kdbx")
+	writeTestKDBX(t, dbPath, "master")
+
+	pwFile := filepath.Join(dir, "password")
+	os.WriteFile(pwFile, []byte("master\n"), 0600)
+
+	ctx := context.Background()
+	m, err := NewKDBXManager(ctx, KDBXConfig{Path: dbPath, PasswordFile: pwFile})
+	if err != nil {
+		t.Fatalf("NewKDBXManager: %v", err)
+	}
+
+	refs, err := m.ListSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(refs)
+	want := []string{"kdbx://Servers/Web/Password", "kdbx://Servers/Web/UserName", "kdbx://Servers/Web/tls.crt"}
+	if len(refs) != len(want) {
+		t.Fatalf("ListSecrets: got %v, want %v", refs, want)
+	}
+	for i := range want {
+		if refs[i] != want[i] {
+			t.Errorf("ListSecrets[%d]: got %q, want %q", i, refs[i], want[i])
+		}
+	}
+
+	// Replace the database behind the manager's back
+	other := filepath.Join(dir, "other.kdbx")
+	writeTestKDBX(t, other, "master")
+	other2, _ := NewKDBXManager(ctx, KDBXConfig{Path: other, PasswordFile: pwFile})
+	if err := other2.Write(ctx, "kdbx://Servers/Web/Password", "changed-elsewhere"); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second)
+	os.Chtimes(other, later, later)
+	if err := os.Rename(other, dbPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, _ := m.Resolve(ctx, "kdbx://Servers/Web/Password"); got != "changed-elsewhere" {
+		t.Errorf("expected reload after change on disk, got %q", got)
+	}
+}
@@ -0,0 +1,307 @@
+//go:build linux
+
+package secretmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// keyringID maps a keyring name to its special ID (or, for "persistent",
+// the ID of the caller's persistent keyring)
+func keyringID(name string) (int, error) {
+	switch name {
+	case "thread":
+		return unix.KEY_SPEC_THREAD_KEYRING, nil
+	case "process":
+		return unix.KEY_SPEC_PROCESS_KEYRING, nil
+	case "session":
+		return unix.KEY_SPEC_SESSION_KEYRING, nil
+	case "user":
+		return unix.KEY_SPEC_USER_KEYRING, nil
+	case "user-session":
+		return unix.KEY_SPEC_USER_SESSION_KEYRING, nil
+	case "persistent":
+		id, err := unix.KeyctlInt(unix.KEYCTL_GET_PERSISTENT, -1, unix.KEY_SPEC_SESSION_KEYRING, 0, 0)
+		if err != nil {
+			return 0, fmt.Errorf("persistent keyring unavailable: %w", err)
+		}
+		return id, nil
+	}
+	return 0, fmt.Errorf("unknown keyring %q (want thread, process, session, user, user-session or persistent)", name)
+}
+
+// keyRead searches keyring for a "user" key with description and returns its payload
+func keyRead(keyring int, description string) ([]byte, error) {
+	id, err := unix.KeyctlSearch(keyring, "user", description, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := make([]byte, 512)
+	for {
+		n, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+		if n <= len(buf) {
+			return buf[:n], nil
+		}
+		buf = make([]byte, n)
+	}
+}
+
+// Possessor permission bits from <linux/keyctl.h>
+const (
+	keyPosView    = 0x01000000
+	keyPosRead    = 0x02000000
+	keyPosWrite   = 0x04000000
+	keyPosSearch  = 0x08000000
+	keyPosSetattr = 0x20000000
+)
+
+// keyPerm grants access to possessors only, so processes of the same user
+// that don't hold the keyring can't even view the key
+const keyPerm = keyPosView | keyPosRead | keyPosWrite | keyPosSearch | keyPosSetattr
+
+// keyWrite adds or updates a "user" key, expiring it after ttl if non-zero.
+// The kernel counts timeouts in whole seconds, so ttl is rounded up.
+func keyWrite(keyring int, description string, payload []byte, ttl time.Duration) error {
+	id, err := unix.AddKey("user", description, payload, keyring)
+	if err != nil {
+		return err
+	}
+	// A key we can't restrict, e.g. one planted by another owner, is dropped
+	if err := unix.KeyctlSetperm(id, keyPerm); err != nil {
+		unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0)
+		return fmt.Errorf("restricting key permissions: %w", err)
+	}
+	if ttl > 0 {
+		secs := int((ttl + time.Second - 1) / time.Second)
+		if _, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, secs, 0, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyInvalidate removes a key from keyring if present
+func keyInvalidate(keyring int, description string) error {
+	id, err := unix.KeyctlSearch(keyring, "user", description, 0)
+	if errors.Is(err, unix.ENOKEY) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	_, err = unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0)
+	return err
+}
+
+// KeyringManager resolves keyring://<keyring>/<description> references to
+// "user" keys in the Linux kernel keyring.
+type KeyringManager struct {
+	secrets []string // configured secret references
+}
+
+func NewKeyringManager(ctx context.Context, secrets []string) (*KeyringManager, error) {
+	return &KeyringManager{
+		secrets: secrets,
+	}, nil
+}
+
+// parseKeyringReference extracts the keyring and key description from "keyring://session/desc"
+func parseKeyringReference(reference string) (int, string, error) {
+	if !strings.HasPrefix(reference, "keyring://") {
+		return 0, "", fmt.Errorf("invalid reference format: must start with keyring://")
+	}
+	name, description, _ := strings.Cut(strings.TrimPrefix(reference, "keyring://"), "/")
+	if name == "" || description == "" {
+		return 0, "", fmt.Errorf("invalid reference format: expected keyring://<keyring>/<description>")
+	}
+	id, err := keyringID(name)
+	if err != nil {
+		return 0, "", err
+	}
+	return id, description, nil
+}
+
+func (m *KeyringManager) Resolve(ctx context.Context, reference string) (string, error) {
+	keyring, description, err := parseKeyringReference(reference)
+	if err != nil {
+		return "", err
+	}
+	payload, err := keyRead(keyring, description)
+	if err != nil {
+		return "", fmt.Errorf("reading key %q: %w", description, err)
+	}
+	return string(payload), nil
+}
+
+func (m *KeyringManager) Write(ctx context.Context, reference string, value string) error {
+	keyring, description, err := parseKeyringReference(reference)
+	if err != nil {
+		return err
+	}
+	if err := keyWrite(keyring, description, []byte(value), 0); err != nil {
+		return fmt.Errorf("writing key %q: %w", description, err)
+	}
+	return nil
+}
+
+func (m *KeyringManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *KeyringManager) Name() string {
+	return "keyring"
+}
+
+// KeyringCache wraps a SecretManager and keeps resolved values in a kernel
+// keyring instead of re-fetching them, so they survive a daemon restart
+// within the same login session without prompting the backend again.
+type KeyringCache struct {
+	SecretManager
+	keyring int // the daemon's own keyring, linked into the configured one
+	ttl     time.Duration
+	private []string
+}
+
+// defaultCacheTTL bounds how long changes made directly in the backend go unseen
+const defaultCacheTTL = 15 * time.Minute
+
+// cacheKeyring is the description of the keyring holding cached values
+const cacheKeyring = "secrets-fuse"
+
+// NewKeyringCache caches values from inner in a keyring of the daemon's own,
+// linked into the named keyring ("session" by default), for ttl (15m if
+// zero). Every process possessing the named keyring can read the cache, so
+// private lists the references of secrets with access rules, which are
+// never cached. A wildcard in private disables caching for its whole scheme,
+// as providers may expand it to references by ID.
+func NewKeyringCache(inner SecretManager, keyring string, ttl time.Duration, private []string) (*KeyringCache, error) {
+	// The kernel counts timeouts in whole seconds
+	if ttl < 0 || (ttl > 0 && ttl < time.Second) {
+		return nil, fmt.Errorf("keyring cache ttl %v must be at least 1s", ttl)
+	}
+	if ttl == 0 {
+		ttl = defaultCacheTTL
+	}
+	if keyring == "" {
+		keyring = "session"
+	}
+	parent, err := keyringID(keyring)
+	if err != nil {
+		return nil, err
+	}
+	// Make sure the keyring exists so cached keys outlive this process
+	if _, err := unix.KeyctlGetKeyringID(parent, true); err != nil {
+		return nil, fmt.Errorf("%s keyring unavailable: %w", keyring, err)
+	}
+	id, err := ownKeyring(parent)
+	if err != nil {
+		return nil, fmt.Errorf("%s keyring: %w", keyring, err)
+	}
+
+	return &KeyringCache{
+		SecretManager: inner,
+		keyring:       id,
+		ttl:           ttl,
+		private:       private,
+	}, nil
+}
+
+// ownKeyring returns the cache keyring linked into parent, replacing one
+// that wasn't created by this user with the expected permissions
+func ownKeyring(parent int) (int, error) {
+	if id, err := unix.KeyctlSearch(parent, "keyring", cacheKeyring, 0); err == nil && ownedKey(id) {
+		return id, nil
+	}
+	// Adding a keyring with the same description replaces the link in parent
+	id, err := unix.AddKey("keyring", cacheKeyring, nil, parent)
+	if err != nil {
+		return 0, err
+	}
+	if err := unix.KeyctlSetperm(id, keyPerm); err != nil {
+		return 0, fmt.Errorf("restricting keyring permissions: %w", err)
+	}
+	return id, nil
+}
+
+// ownedKey reports whether key belongs to this user and has the permissions
+// the daemon sets, so it wasn't planted by someone else
+func ownedKey(id int) bool {
+	// Description is "type;uid;gid;perm;description"
+	desc, err := unix.KeyctlString(unix.KEYCTL_DESCRIBE, id)
+	if err != nil {
+		return false
+	}
+	fields := strings.SplitN(desc, ";", 5)
+	return len(fields) == 5 && fields[1] == strconv.Itoa(os.Getuid()) && fields[3] == fmt.Sprintf("%08x", keyPerm)
+}
+
+// cacheable reports whether reference may be kept in the keyring
+func (c *KeyringCache) cacheable(reference string) bool {
+	for _, p := range c.private {
+		if p == reference || (IsWildcard(p) && Scheme(p) == Scheme(reference)) {
+			return false
+		}
+	}
+	return true
+}
+
+func cacheDescription(reference string) string {
+	return "secrets-fuse:" + reference
+}
+
+func (c *KeyringCache) Resolve(ctx context.Context, reference string) (string, error) {
+	if !c.cacheable(reference) {
+		return c.SecretManager.Resolve(ctx, reference)
+	}
+	description := cacheDescription(reference)
+	if id, err := unix.KeyctlSearch(c.keyring, "user", description, 0); err == nil {
+		if ownedKey(id) {
+			if payload, err := keyRead(c.keyring, description); err == nil {
+				return string(payload), nil
+			}
+		} else {
+			log.Printf("Keyring cache: ignoring %s, not created by the daemon", description)
+			unix.KeyctlInt(unix.KEYCTL_INVALIDATE, id, 0, 0, 0)
+		}
+	}
+
+	val, err := c.SecretManager.Resolve(ctx, reference)
+	if err != nil {
+		return "", err
+	}
+	// A failed cache write only costs a backend round trip next time
+	keyWrite(c.keyring, description, []byte(val), c.ttl)
+	return val, nil
+}
+
+// Clear drops every cached value, e.g. on refresh
+func (c *KeyringCache) Clear() error {
+	_, err := unix.KeyctlInt(unix.KEYCTL_CLEAR, c.keyring, 0, 0, 0)
+	return err
+}
+
+func (c *KeyringCache) Write(ctx context.Context, reference string, value string) error {
+	if err := c.SecretManager.Write(ctx, reference, value); err != nil {
+		return err
+	}
+	// Drop rather than update, as the backend may normalize what was written
+	return keyInvalidate(c.keyring, cacheDescription(reference))
+}
+
+// Expand passes wildcard patterns through uncached, so refreshes see new secrets
+func (c *KeyringCache) Expand(ctx context.Context, pattern string) ([]Expansion, error) {
+	return Expand(ctx, c.SecretManager, pattern)
+}
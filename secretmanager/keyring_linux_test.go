@@ -0,0 +1,197 @@
+//go:build linux
+
+package secretmanager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func requireKeyring(t *testing.T) {
+	t.Helper()
+	if _, err := unix.KeyctlGetKeyringID(unix.KEY_SPEC_SESSION_KEYRING, true); err != nil {
+		t.Skipf("session keyring unavailable: %v", err)
+	}
+}
+
+func TestKeyringResolveAndWrite(t *testing.T) {
+	requireKeyring(t)
+	ctx := context.Background()
+
+	m, err := NewKeyringManager(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ref := fmt.Sprintf("keyring://session/secrets-fuse-test/%d", os.Getpid())
+	defer keyInvalidate(unix.KEY_SPEC_SESSION_KEYRING, ref[len("keyring://session/"):])
+
+	if _, err := m.Resolve(ctx, ref); err == nil {
+		t.Fatal("expected missing key to fail")
+	}
+	if err := m.Write(ctx, ref, "hunter2"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, err := m.Resolve(ctx, ref); err != nil || got != "hunter2" {
+		t.Errorf("Resolve: got %q, %v", got, err)
+	}
+
+	big := make([]byte, 4096)
+	for i := range big {
+		big[i] = 'x'
+	}
+	if err := m.Write(ctx, ref, string(big)); err != nil {
+		t.Fatalf("Write large: %v", err)
+	}
+	if got, _ := m.Resolve(ctx, ref); got != string(big) {
+		t.Errorf("large payload truncated to %d bytes", len(got))
+	}
+
+	if _, err := m.Resolve(ctx, "keyring://nosuchring/x"); err == nil {
+		t.Error("expected unknown keyring to fail")
+	}
+}
+
+// countingManager counts Resolve calls to the backend
+type countingManager struct {
+	stubManager
+	resolves int
+}
+
+func (m *countingManager) Resolve(ctx context.Context, reference string) (string, error) {
+	m.resolves++
+	if val, ok := m.secrets[reference]; ok {
+		return val, nil
+	}
+	return "", errors.New("not found")
+}
+
+func TestKeyringCache(t *testing.T) {
+	requireKeyring(t)
+	ctx := context.Background()
+
+	ref := fmt.Sprintf("op://cache-test/%d/password", os.Getpid())
+	backend := &countingManager{stubManager: stubManager{name: "stub", secrets: map[string]string{ref: "v1"}}}
+	cache, err := NewKeyringCache(backend, "session", time.Minute, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyInvalidate(cache.keyring, cacheDescription(ref))
+
+	for range 3 {
+		if got, err := cache.Resolve(ctx, ref); err != nil || got != "v1" {
+			t.Fatalf("Resolve: got %q, %v", got, err)
+		}
+	}
+	if backend.resolves != 1 {
+		t.Errorf("expected 1 backend resolve, got %d", backend.resolves)
+	}
+
+	// A new cache (e.g. after a daemon restart) is served from the keyring
+	restarted, _ := NewKeyringCache(backend, "session", time.Minute, nil)
+	if got, _ := restarted.Resolve(ctx, ref); got != "v1" || backend.resolves != 1 {
+		t.Errorf("restarted cache: got %q with %d backend resolves", got, backend.resolves)
+	}
+
+	if err := cache.Write(ctx, ref, "v2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cache.Resolve(ctx, ref); got != "v2" {
+		t.Errorf("Resolve after write: got %q", got)
+	}
+	if backend.resolves != 2 {
+		t.Errorf("expected write to invalidate the cache, got %d backend resolves", backend.resolves)
+	}
+
+	if err := cache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if cache.Resolve(ctx, ref); backend.resolves != 3 {
+		t.Errorf("expected Clear to drop the cache, got %d backend resolves", backend.resolves)
+	}
+
+	if cache.Name() != "stub" {
+		t.Errorf("Name: got %q", cache.Name())
+	}
+}
+
+func TestKeyringCacheKeyPermsAndTTL(t *testing.T) {
+	requireKeyring(t)
+	ctx := context.Background()
+
+	if _, err := NewKeyringCache(&stubManager{}, "session", 500*time.Millisecond, nil); err == nil {
+		t.Error("expected sub-second ttl to be rejected")
+	}
+
+	ref := fmt.Sprintf("op://perm-test/%d/password", os.Getpid())
+	backend := &stubManager{name: "stub", secrets: map[string]string{ref: "v1"}}
+	cache, err := NewKeyringCache(backend, "session", 1500*time.Millisecond, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer keyInvalidate(cache.keyring, cacheDescription(ref))
+	if _, err := cache.Resolve(ctx, ref); err != nil {
+		t.Fatal(err)
+	}
+
+	// Values live in the daemon's own keyring, not directly in the session's
+	if _, err := unix.KeyctlSearch(unix.KEY_SPEC_SESSION_KEYRING, "keyring", cacheKeyring, 0); err != nil {
+		t.Errorf("cache keyring not linked into the session keyring: %v", err)
+	}
+	id, err := unix.KeyctlSearch(cache.keyring, "user", cacheDescription(ref), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []int{cache.keyring, id} {
+		if !ownedKey(key) {
+			desc, _ := unix.KeyctlString(unix.KEYCTL_DESCRIBE, key)
+			t.Errorf("key description %q, want perm %08x", desc, keyPerm)
+		}
+	}
+}
+
+func TestKeyringCacheUntrustedKeys(t *testing.T) {
+	requireKeyring(t)
+	ctx := context.Background()
+
+	ref := fmt.Sprintf("op://planted/%d/password", os.Getpid())
+	private := fmt.Sprintf("op://private/%d/password", os.Getpid())
+	backend := &countingManager{stubManager: stubManager{name: "stub", secrets: map[string]string{
+		ref:                    "real",
+		private:                "restricted",
+		"vault://kv/app/token": "token",
+	}}}
+	cache, err := NewKeyringCache(backend, "session", time.Minute, []string{private, "vault://kv/*/token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Clear()
+
+	// A key with the default permissions wasn't stored by the daemon
+	if _, err := unix.AddKey("user", cacheDescription(ref), []byte("planted"), cache.keyring); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := cache.Resolve(ctx, ref); got != "real" {
+		t.Errorf("Resolve served planted key: got %q", got)
+	}
+
+	// Secrets with access rules are never cached
+	for _, r := range []string{private, "vault://kv/app/token"} {
+		before := backend.resolves
+		for range 2 {
+			cache.Resolve(ctx, r)
+		}
+		if backend.resolves != before+2 {
+			t.Errorf("%s: expected every resolve to reach the backend", r)
+		}
+		if _, err := unix.KeyctlSearch(cache.keyring, "user", cacheDescription(r), 0); err == nil {
+			t.Errorf("%s was cached", r)
+		}
+	}
+}
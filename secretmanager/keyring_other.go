@@ -0,0 +1,31 @@
+//go:build !linux
+
+package secretmanager
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var errNoKeyring = fmt.Errorf("kernel keyring is only available on Linux")
+
+type KeyringManager struct {
+	SecretManager
+}
+
+func NewKeyringManager(ctx context.Context, secrets []string) (*KeyringManager, error) {
+	return nil, errNoKeyring
+}
+
+type KeyringCache struct {
+	SecretManager
+}
+
+func NewKeyringCache(inner SecretManager, keyring string, ttl time.Duration, private []string) (*KeyringCache, error) {
+	return nil, errNoKeyring
+}
+
+func (c *KeyringCache) Clear() error {
+	return errNoKeyring
+}
@@ -0,0 +1,164 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// KubernetesConfig configures access to Kubernetes Secrets. The in-cluster
+// service account is used when no kubeconfig is found.
+type KubernetesConfig struct {
+	Kubeconfig    string // defaults to KUBECONFIG or ~/.kube/config
+	Context       string // defaults to the kubeconfig's current context
+	LabelSelector string // if set, ListSecrets includes every key of matching Secrets
+}
+
+// KubernetesManager resolves k8s://namespace/secret/key references to keys
+// of Kubernetes Secrets.
+type KubernetesManager struct {
+	client           kubernetes.Interface
+	defaultNamespace string
+	labelSelector    string
+	secrets          []string // configured secret references
+}
+
+func NewKubernetesManager(ctx context.Context, secrets []string, cfg KubernetesConfig) (*KubernetesManager, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if cfg.Kubeconfig != "" {
+		rules.ExplicitPath = expandHome(cfg.Kubeconfig)
+	}
+	clientConfig := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{CurrentContext: cfg.Context})
+
+	restConfig, err := clientConfig.ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	namespace, _, err := clientConfig.Namespace()
+	if err != nil {
+		return nil, fmt.Errorf("loading kubeconfig: %w", err)
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, err
+	}
+	return newKubernetesManager(client, namespace, secrets, cfg), nil
+}
+
+func newKubernetesManager(client kubernetes.Interface, namespace string, secrets []string, cfg KubernetesConfig) *KubernetesManager {
+	return &KubernetesManager{
+		client:           client,
+		defaultNamespace: namespace,
+		labelSelector:    cfg.LabelSelector,
+		secrets:          secrets,
+	}
+}
+
+// parseKubernetesReference extracts the namespace, Secret name and key from "k8s://namespace/name/key"
+func parseKubernetesReference(reference string) (namespace, name, key string, err error) {
+	if !strings.HasPrefix(reference, "k8s://") {
+		return "", "", "", fmt.Errorf("invalid reference format: must start with k8s://")
+	}
+	parts := strings.Split(strings.TrimPrefix(reference, "k8s://"), "/")
+	if len(parts) != 3 || slices.Contains(parts, "") {
+		return "", "", "", fmt.Errorf("invalid reference format: expected k8s://<namespace>/<secret>/<key>")
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+func (m *KubernetesManager) Resolve(ctx context.Context, reference string) (string, error) {
+	namespace, name, key, err := parseKubernetesReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := m.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+	val, ok := secret.Data[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in secret %s/%s", key, namespace, name)
+	}
+	return string(val), nil
+}
+
+// Write sets one key of the Secret with a merge patch, leaving its other keys
+// alone. Missing Secrets are created as Opaque.
+func (m *KubernetesManager) Write(ctx context.Context, reference string, value string) error {
+	namespace, name, key, err := parseKubernetesReference(reference)
+	if err != nil {
+		return err
+	}
+
+	// []byte values marshal to base64, as the data field expects
+	patch, err := json.Marshal(map[string]any{"data": map[string][]byte{key: []byte(value)}})
+	if err != nil {
+		return err
+	}
+	secrets := m.client.CoreV1().Secrets(namespace)
+	_, err = secrets.Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = secrets.Create(ctx, &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Type:       corev1.SecretTypeOpaque,
+			Data:       map[string][]byte{key: []byte(value)},
+		}, metav1.CreateOptions{})
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write secret %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
+
+// ListSecrets returns the configured references and, with a label selector,
+// the keys of matching Secrets in the namespaces those references use (or
+// the default namespace).
+func (m *KubernetesManager) ListSecrets(ctx context.Context) ([]string, error) {
+	if m.labelSelector == "" {
+		return m.secrets, nil
+	}
+
+	var namespaces []string
+	for _, ref := range m.secrets {
+		if namespace, _, _, err := parseKubernetesReference(ref); err == nil && !slices.Contains(namespaces, namespace) {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		namespaces = []string{m.defaultNamespace}
+	}
+
+	var listed []string
+	for _, namespace := range namespaces {
+		list, err := m.client.CoreV1().Secrets(namespace).List(ctx, metav1.ListOptions{LabelSelector: m.labelSelector})
+		if err != nil {
+			return nil, fmt.Errorf("listing secrets in %s: %w", namespace, err)
+		}
+		for _, secret := range list.Items {
+			keys := make([]string, 0, len(secret.Data))
+			for key := range secret.Data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				listed = append(listed, "k8s://"+namespace+"/"+secret.Name+"/"+key)
+			}
+		}
+	}
+	return mergeReferences(m.secrets, listed), nil
+}
+
+func (m *KubernetesManager) Name() string {
+	return "kubernetes"
+}
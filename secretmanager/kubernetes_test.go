@@ -0,0 +1,111 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestParseKubernetesReference(t *testing.T) {
+	if ns, name, key, err := parseKubernetesReference("k8s://prod/db-creds/password"); err != nil || ns != "prod" || name != "db-creds" || key != "password" {
+		t.Errorf("got %q %q %q %v", ns, name, key, err)
+	}
+	for _, ref := range []string{"k8s://prod/db-creds", "k8s://prod//password", "k8s://a/b/c/d", "vault://a/b/c"} {
+		if _, _, _, err := parseKubernetesReference(ref); err == nil {
+			t.Errorf("%s: expected error", ref)
+		}
+	}
+}
+
+func TestKubernetesManager(t *testing.T) {
+	client := fake.NewClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "db-creds", Namespace: "prod", Labels: map[string]string{"secrets-fuse": "true"}},
+			Data:       map[string][]byte{"user": []byte("app"), "password": []byte("old")},
+		},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "unlabeled", Namespace: "prod"},
+			Data:       map[string][]byte{"x": []byte("y")},
+		},
+	)
+	ctx := context.Background()
+	refs := []string{"k8s://prod/db-creds/password"}
+	m := newKubernetesManager(client, "default", refs, KubernetesConfig{LabelSelector: "secrets-fuse=true"})
+
+	if got, err := m.Resolve(ctx, "k8s://prod/db-creds/password"); err != nil || got != "old" {
+		t.Errorf("Resolve: got %q, %v", got, err)
+	}
+	if _, err := m.Resolve(ctx, "k8s://prod/db-creds/missing"); err == nil {
+		t.Error("expected missing key to fail")
+	}
+	if _, err := m.Resolve(ctx, "k8s://prod/nope/x"); err == nil {
+		t.Error("expected missing secret to fail")
+	}
+
+	if err := m.Write(ctx, "k8s://prod/db-creds/password", "new"); err != nil {
+		t.Fatal(err)
+	}
+	secret, _ := client.CoreV1().Secrets("prod").Get(ctx, "db-creds", metav1.GetOptions{})
+	if string(secret.Data["password"]) != "new" || string(secret.Data["user"]) != "app" {
+		t.Errorf("patch should only change one key: %v", secret.Data)
+	}
+
+	if err := m.Write(ctx, "k8s://prod/api/token", "t0k3n"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, "k8s://prod/api/token"); got != "t0k3n" {
+		t.Errorf("Resolve created secret: got %q", got)
+	}
+
+	listed, err := m.ListSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"k8s://prod/db-creds/password", "k8s://prod/db-creds/user"}
+	if !slices.Equal(listed, want) {
+		t.Errorf("ListSecrets: got %v, want %v", listed, want)
+	}
+}
+
+func TestNewKubernetesManagerKubeconfig(t *testing.T) {
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	err := os.WriteFile(kubeconfig, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+    namespace: team-a
+current-context: test
+users:
+- name: test
+  user:
+    token: abc
+`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewKubernetesManager(context.Background(), nil, KubernetesConfig{Kubeconfig: kubeconfig})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.defaultNamespace != "team-a" {
+		t.Errorf("default namespace: got %q", m.defaultNamespace)
+	}
+
+	if _, err := NewKubernetesManager(context.Background(), nil, KubernetesConfig{Kubeconfig: kubeconfig, Context: "nope"}); err == nil {
+		t.Error("expected unknown context to fail")
+	}
+}
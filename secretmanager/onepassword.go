@@ -2,18 +2,133 @@ package secretmanager
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"path"
+	"slices"
 	"strings"
+	"sync"
 
 	"github.com/1password/onepassword-sdk-go"
 )
 
+// OnePasswordConfig configures authentication for OnePasswordManager.
+// Account selects desktop app integration; without it a service account
+// token is used, taken from ServiceAccountToken, ServiceAccountTokenFile or
+// OP_SERVICE_ACCOUNT_TOKEN in that order.
+type OnePasswordConfig struct {
+	Account                 string
+	Accounts                map[string]string // per-reference account overrides
+	ServiceAccountToken     string
+	ServiceAccountTokenFile string
+}
+
 type OnePasswordManager struct {
-	client  *onepassword.Client
-	secrets []string // configured secret references
+	account  string            // default account
+	accounts map[string]string // per-reference account overrides
+	token    string            // service account token, used when account is empty
+	secrets  []string          // configured secret references
+
+	mu      sync.Mutex
+	clients map[string]*opClient // keyed by account
+
+	dial func(ctx context.Context, account string) (*onepassword.Client, error)
+}
+
+// opClient is a pooled client, usable once ready is closed. Creating one may
+// wait on a desktop app prompt, so it happens outside m.mu.
+type opClient struct {
+	ready  chan struct{}
+	client *onepassword.Client
+	err    error
+}
+
+// NewOnePasswordManager creates a manager for the default account in cfg.
+// Clients for per-reference account overrides are created on first use.
+func NewOnePasswordManager(ctx context.Context, secrets []string, cfg OnePasswordConfig) (*OnePasswordManager, error) {
+	m := &OnePasswordManager{
+		account:  cfg.Account,
+		accounts: cfg.Accounts,
+		secrets:  secrets,
+		clients:  make(map[string]*opClient),
+	}
+	m.dial = m.newClient
+
+	usesDefault := slices.ContainsFunc(secrets, func(ref string) bool { return m.accounts[ref] == "" })
+
+	// The default account also serves wildcard expansion and item exports,
+	// so a configured token is loaded even if every secret overrides it
+	if m.account == "" {
+		token, err := serviceAccountToken(cfg)
+		if err != nil && (usesDefault || !errors.Is(err, errNoToken)) {
+			return nil, err
+		}
+		m.token = token
+	}
+
+	// Fail early if the default account is in use but unusable
+	if usesDefault {
+		if _, err := m.clientForAccount(ctx, m.account); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+var errNoToken = errors.New("no 1Password account or service account token configured (set op_account, op_service_account or OP_SERVICE_ACCOUNT_TOKEN)")
+
+// serviceAccountToken picks the service account token from cfg or the environment
+func serviceAccountToken(cfg OnePasswordConfig) (string, error) {
+	switch {
+	case cfg.ServiceAccountToken != "":
+		return cfg.ServiceAccountToken, nil
+	case cfg.ServiceAccountTokenFile != "":
+		return readTokenFile(cfg.ServiceAccountTokenFile)
+	case os.Getenv("OP_SERVICE_ACCOUNT_TOKEN") != "":
+		return os.Getenv("OP_SERVICE_ACCOUNT_TOKEN"), nil
+	}
+	return "", errNoToken
+}
+
+// clientForAccount returns the pooled client for account, creating it if
+// needed. Concurrent callers for the same account share one attempt; a failed
+// attempt is not cached, so the account can recover later.
+func (m *OnePasswordManager) clientForAccount(ctx context.Context, account string) (*onepassword.Client, error) {
+	m.mu.Lock()
+	c, ok := m.clients[account]
+	if !ok {
+		c = &opClient{ready: make(chan struct{})}
+		m.clients[account] = c
+	}
+	m.mu.Unlock()
+
+	if ok {
+		select {
+		case <-c.ready:
+			return c.client, c.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	c.client, c.err = m.dial(ctx, account)
+	if c.err != nil {
+		m.mu.Lock()
+		delete(m.clients, account)
+		m.mu.Unlock()
+	}
+	close(c.ready)
+	return c.client, c.err
 }
 
-func NewOnePasswordManager(ctx context.Context, secrets []string, account string) (*OnePasswordManager, error) {
+// newClient creates a client for account, or for the service account token
+func (m *OnePasswordManager) newClient(ctx context.Context, account string) (*onepassword.Client, error) {
+	if account == "" && m.token == "" {
+		return nil, errNoToken
+	}
+
 	opts := []onepassword.ClientOption{
 		onepassword.WithIntegrationInfo("secrets-fuse", "1.0.0"),
 	}
@@ -21,26 +136,46 @@ func NewOnePasswordManager(ctx context.Context, secrets []string, account string
 	if account != "" {
 		opts = append(opts, onepassword.WithDesktopAppIntegration(account))
 	} else {
-		token := ""
-		opts = append(opts, onepassword.WithServiceAccountToken(token))
+		opts = append(opts, onepassword.WithServiceAccountToken(m.token))
 	}
 
 	client, err := onepassword.NewClient(ctx, opts...)
 	if err != nil {
-		return nil, err
+		if account != "" {
+			return nil, fmt.Errorf("1password account %q: desktop app integration unavailable (is the app running, unlocked and integrated with other apps?): %w", account, err)
+		}
+		return nil, fmt.Errorf("1password service account: %w", err)
 	}
+	return client, nil
+}
 
-	return &OnePasswordManager{
-		client:  client,
-		secrets: secrets,
-	}, nil
+// clientFor returns the client for the account configured for reference
+func (m *OnePasswordManager) clientFor(ctx context.Context, reference string) (*onepassword.Client, error) {
+	account := m.account
+	m.mu.Lock()
+	if override, ok := m.accounts[reference]; ok && override != "" {
+		account = override
+	}
+	m.mu.Unlock()
+	return m.clientForAccount(ctx, account)
 }
 
 func (m *OnePasswordManager) Resolve(ctx context.Context, reference string) (string, error) {
-	return m.client.Secrets().Resolve(ctx, reference)
+	if vault, item, format, ok, err := parseItemReference(reference); ok {
+		if err != nil {
+			return "", err
+		}
+		return m.resolveItem(ctx, reference, vault, item, format)
+	}
+
+	client, err := m.clientFor(ctx, reference)
+	if err != nil {
+		return "", err
+	}
+	return client.Secrets().Resolve(ctx, reference)
 }
 
-// parseReference extracts vault, item, and field from "op://vault/item/field"
+// parseReference extracts vault, item, and field from "op://vault/item/[section/]field"
 func parseReference(reference string) (vaultID, itemID, fieldID string, err error) {
 	if !strings.HasPrefix(reference, "op://") {
 		return "", "", "", fmt.Errorf("invalid reference format: must start with op://")
@@ -49,39 +184,51 @@ func parseReference(reference string) (vaultID, itemID, fieldID string, err erro
 	if len(parts) < 3 {
 		return "", "", "", fmt.Errorf("invalid reference format: expected op://vault/item/field")
 	}
-	return parts[0], parts[1], parts[2], nil
+	return parts[0], parts[1], parts[len(parts)-1], nil
 }
 
 func (m *OnePasswordManager) Write(ctx context.Context, reference string, value string) error {
+	if vault, item, format, ok, err := parseItemReference(reference); ok {
+		if err != nil {
+			return err
+		}
+		return m.writeItem(ctx, reference, vault, item, format, value)
+	}
+
 	vaultID, itemID, fieldID, err := parseReference(reference)
 	if err != nil {
 		return err
 	}
 
-	item, err := m.client.Items().Get(ctx, vaultID, itemID)
+	client, err := m.clientFor(ctx, reference)
+	if err != nil {
+		return err
+	}
+
+	item, err := client.Items().Get(ctx, vaultID, itemID)
 	if err != nil {
 		return fmt.Errorf("failed to get item: %w", err)
 	}
 
 	// Handle Document items (file-based)
 	if item.Category == onepassword.ItemCategoryDocument && item.Document != nil {
-		return m.writeDocument(ctx, item, fieldID, []byte(value))
+		return writeDocument(ctx, client, item, fieldID, []byte(value))
 	}
 
 	// Handle file attachments
 	for _, file := range item.Files {
 		if file.Attributes.Name == fieldID {
-			return m.writeFileAttachment(ctx, item, file, []byte(value))
+			return writeFileAttachment(ctx, client, item, file, []byte(value))
 		}
 	}
 
 	// Handle field-based items
-	return m.writeField(ctx, item, fieldID, value)
+	return writeField(ctx, client, item, fieldID, value)
 }
 
-func (m *OnePasswordManager) writeDocument(ctx context.Context, item onepassword.Item, filename string, content []byte) error {
+func writeDocument(ctx context.Context, client *onepassword.Client, item onepassword.Item, filename string, content []byte) error {
 	// Read current content for backup
-	oldContent, err := m.client.Items().Files().Read(ctx, item.VaultID, item.ID, *item.Document)
+	oldContent, err := client.Items().Files().Read(ctx, item.VaultID, item.ID, *item.Document)
 	if err != nil {
 		return fmt.Errorf("failed to read current document: %w", err)
 	}
@@ -90,7 +237,7 @@ func (m *OnePasswordManager) writeDocument(ctx context.Context, item onepassword
 	backupFieldID := "backup_" + item.Document.Name
 	for _, file := range item.Files {
 		if file.FieldID == backupFieldID {
-			item, err = m.client.Items().Files().Delete(ctx, item, file.SectionID, file.FieldID)
+			item, err = client.Items().Files().Delete(ctx, item, file.SectionID, file.FieldID)
 			if err != nil {
 				return fmt.Errorf("failed to delete old backup: %w", err)
 			}
@@ -100,7 +247,7 @@ func (m *OnePasswordManager) writeDocument(ctx context.Context, item onepassword
 
 	// Attach backup as .bak file
 	backupName := item.Document.Name + ".bak"
-	item, err = m.client.Items().Files().Attach(ctx, item, onepassword.FileCreateParams{
+	item, err = client.Items().Files().Attach(ctx, item, onepassword.FileCreateParams{
 		Name:    backupName,
 		Content: oldContent,
 		FieldID: backupFieldID,
@@ -110,7 +257,7 @@ func (m *OnePasswordManager) writeDocument(ctx context.Context, item onepassword
 	}
 
 	// Replace the document
-	_, err = m.client.Items().Files().ReplaceDocument(ctx, item, onepassword.DocumentCreateParams{
+	_, err = client.Items().Files().ReplaceDocument(ctx, item, onepassword.DocumentCreateParams{
 		Name:    filename,
 		Content: content,
 	})
@@ -121,22 +268,22 @@ func (m *OnePasswordManager) writeDocument(ctx context.Context, item onepassword
 	return nil
 }
 
-func (m *OnePasswordManager) writeFileAttachment(ctx context.Context, item onepassword.Item, file onepassword.ItemFile, content []byte) error {
+func writeFileAttachment(ctx context.Context, client *onepassword.Client, item onepassword.Item, file onepassword.ItemFile, content []byte) error {
 	// Read current content for backup
-	oldContent, err := m.client.Items().Files().Read(ctx, item.VaultID, item.ID, file.Attributes)
+	oldContent, err := client.Items().Files().Read(ctx, item.VaultID, item.ID, file.Attributes)
 	if err != nil {
 		return fmt.Errorf("failed to read current file: %w", err)
 	}
 
 	// Delete the old file
-	item, err = m.client.Items().Files().Delete(ctx, item, file.SectionID, file.FieldID)
+	item, err = client.Items().Files().Delete(ctx, item, file.SectionID, file.FieldID)
 	if err != nil {
 		return fmt.Errorf("failed to delete old file: %w", err)
 	}
 
 	// Attach backup
 	backupName := file.Attributes.Name + ".bak"
-	item, err = m.client.Items().Files().Attach(ctx, item, onepassword.FileCreateParams{
+	item, err = client.Items().Files().Attach(ctx, item, onepassword.FileCreateParams{
 		Name:      backupName,
 		Content:   oldContent,
 		SectionID: file.SectionID,
@@ -147,7 +294,7 @@ func (m *OnePasswordManager) writeFileAttachment(ctx context.Context, item onepa
 	}
 
 	// Attach new file
-	_, err = m.client.Items().Files().Attach(ctx, item, onepassword.FileCreateParams{
+	_, err = client.Items().Files().Attach(ctx, item, onepassword.FileCreateParams{
 		Name:      file.Attributes.Name,
 		Content:   content,
 		SectionID: file.SectionID,
@@ -160,7 +307,22 @@ func (m *OnePasswordManager) writeFileAttachment(ctx context.Context, item onepa
 	return nil
 }
 
-func (m *OnePasswordManager) writeField(ctx context.Context, item onepassword.Item, fieldID string, value string) error {
+func writeField(ctx context.Context, client *onepassword.Client, item onepassword.Item, fieldID string, value string) error {
+	if err := setFieldWithBackup(&item, fieldID, value); err != nil {
+		return err
+	}
+
+	_, err := client.Items().Put(ctx, item)
+	if err != nil {
+		return fmt.Errorf("failed to update item: %w", err)
+	}
+
+	return nil
+}
+
+// setFieldWithBackup sets a field's value, keeping the old one in a
+// "<field>_previous" field.
+func setFieldWithBackup(item *onepassword.Item, fieldID string, value string) error {
 	var fieldIdx = -1
 	var prevFieldIdx = -1
 	prevFieldID := fieldID + "_previous"
@@ -193,17 +355,160 @@ func (m *OnePasswordManager) writeField(ctx context.Context, item onepassword.It
 	}
 
 	item.Fields[fieldIdx].Value = value
+	return nil
+}
+
+// ListSecrets returns the configured references with wildcard patterns expanded
+func (m *OnePasswordManager) ListSecrets(ctx context.Context) ([]string, error) {
+	var refs []string
+	for _, ref := range m.secrets {
+		if !IsWildcard(ref) {
+			refs = append(refs, ref)
+			continue
+		}
+		matches, err := m.Expand(ctx, ref)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			refs = append(refs, match.Reference)
+		}
+	}
+	return refs, nil
+}
 
-	_, err := m.client.Items().Put(ctx, item)
+// Expand lists vaults, items and fields matching pattern. Matches are
+// referenced by ID so renames between refreshes don't break open files, and
+// inherit the pattern's account override.
+func (m *OnePasswordManager) Expand(ctx context.Context, pattern string) ([]Expansion, error) {
+	client, err := m.clientFor(ctx, pattern)
 	if err != nil {
-		return fmt.Errorf("failed to update item: %w", err)
+		return nil, err
+	}
+	matches, err := expandOnePassword(ctx, sdkLister{client}, pattern)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if account := m.accounts[pattern]; account != "" {
+		for _, match := range matches {
+			m.accounts[match.Reference] = account
+		}
+	}
+	return matches, nil
 }
 
-func (m *OnePasswordManager) ListSecrets(ctx context.Context) ([]string, error) {
-	return m.secrets, nil
+// opLister is the part of the 1Password SDK used to expand wildcards
+type opLister interface {
+	vaults(ctx context.Context) ([]onepassword.VaultOverview, error)
+	items(ctx context.Context, vaultID string) ([]onepassword.ItemOverview, error)
+	item(ctx context.Context, vaultID, itemID string) (onepassword.Item, error)
+}
+
+type sdkLister struct {
+	client *onepassword.Client
+}
+
+func (l sdkLister) vaults(ctx context.Context) ([]onepassword.VaultOverview, error) {
+	return l.client.Vaults().List(ctx)
+}
+
+func (l sdkLister) items(ctx context.Context, vaultID string) ([]onepassword.ItemOverview, error) {
+	return l.client.Items().List(ctx, vaultID)
+}
+
+func (l sdkLister) item(ctx context.Context, vaultID, itemID string) (onepassword.Item, error) {
+	return l.client.Items().Get(ctx, vaultID, itemID)
+}
+
+// matchName matches a pattern segment against a title or an ID
+func matchName(pattern, title, id string) bool {
+	if ok, _ := path.Match(pattern, title); ok {
+		return true
+	}
+	ok, _ := path.Match(pattern, id)
+	return ok
+}
+
+func displayName(title, id string) string {
+	if title != "" {
+		return title
+	}
+	return id
+}
+
+// expandOnePassword matches "op://vault/item/[section/]field" patterns. Without
+// a section segment, fields are matched in every section.
+func expandOnePassword(ctx context.Context, l opLister, pattern string) ([]Expansion, error) {
+	if !strings.HasPrefix(pattern, "op://") {
+		return nil, fmt.Errorf("invalid reference format: must start with op://")
+	}
+	segs := strings.Split(strings.TrimPrefix(pattern, "op://"), "/")
+	if len(segs) != 3 && len(segs) != 4 {
+		return nil, fmt.Errorf("invalid wildcard reference: expected op://vault/item/[section/]field")
+	}
+	first := slices.IndexFunc(segs, IsWildcard)
+	if first == -1 {
+		return nil, fmt.Errorf("reference %s has no wildcard", pattern)
+	}
+
+	vaults, err := l.vaults(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list vaults: %w", err)
+	}
+
+	var matches []Expansion
+	for _, vault := range vaults {
+		if !matchName(segs[0], vault.Title, vault.ID) {
+			continue
+		}
+		overviews, err := l.items(ctx, vault.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list items in %s: %w", vault.Title, err)
+		}
+		for _, overview := range overviews {
+			if !matchName(segs[1], overview.Title, overview.ID) {
+				continue
+			}
+			item, err := l.item(ctx, vault.ID, overview.ID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to get item %s: %w", overview.Title, err)
+			}
+			for _, field := range item.Fields {
+				names := []string{displayName(vault.Title, vault.ID), displayName(item.Title, item.ID)}
+				ref := "op://" + vault.ID + "/" + item.ID + "/"
+				if len(segs) == 4 {
+					section, ok := fieldSection(item, field)
+					if !ok || !matchName(segs[2], section.Title, section.ID) {
+						continue
+					}
+					names = append(names, displayName(section.Title, section.ID))
+					ref += section.ID + "/"
+				}
+				if !matchName(segs[len(segs)-1], field.Title, field.ID) {
+					continue
+				}
+				names = append(names, displayName(field.Title, field.ID))
+				matches = append(matches, Expansion{Reference: ref + field.ID, Path: names[first:]})
+			}
+		}
+	}
+	return matches, nil
+}
+
+// fieldSection returns the section holding field, if any
+func fieldSection(item onepassword.Item, field onepassword.ItemField) (onepassword.ItemSection, bool) {
+	if field.SectionID == nil {
+		return onepassword.ItemSection{}, false
+	}
+	for _, section := range item.Sections {
+		if section.ID == *field.SectionID {
+			return section, true
+		}
+	}
+	return onepassword.ItemSection{}, false
 }
 
 func (m *OnePasswordManager) Name() string {
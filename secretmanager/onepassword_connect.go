@@ -0,0 +1,299 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// OnePasswordConnectConfig configures access to a 1Password Connect server.
+// Host and token fall back to OP_CONNECT_HOST and OP_CONNECT_TOKEN.
+type OnePasswordConnectConfig struct {
+	Host      string
+	Token     string
+	TokenFile string
+}
+
+// OnePasswordConnectManager resolves op:// references through the
+// 1Password Connect REST API, for servers without the desktop app.
+type OnePasswordConnectManager struct {
+	host    string
+	token   string
+	http    *http.Client
+	secrets []string // configured secret references
+}
+
+func NewOnePasswordConnectManager(ctx context.Context, secrets []string, cfg OnePasswordConnectConfig) (*OnePasswordConnectManager, error) {
+	host := cfg.Host
+	if host == "" {
+		host = os.Getenv("OP_CONNECT_HOST")
+	}
+	if host == "" {
+		return nil, fmt.Errorf("no 1Password Connect host configured (set op_connect.host or OP_CONNECT_HOST)")
+	}
+
+	token := cfg.Token
+	if token == "" && cfg.TokenFile != "" {
+		var err error
+		if token, err = readTokenFile(cfg.TokenFile); err != nil {
+			return nil, err
+		}
+	}
+	if token == "" {
+		token = os.Getenv("OP_CONNECT_TOKEN")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no 1Password Connect token configured (set op_connect.token_file or OP_CONNECT_TOKEN)")
+	}
+
+	m := &OnePasswordConnectManager{
+		host:    strings.TrimRight(host, "/"),
+		token:   token,
+		http:    &http.Client{Timeout: 30 * time.Second},
+		secrets: secrets,
+	}
+
+	// Fail early on a bad host or token
+	if err := m.do(ctx, http.MethodGet, "/v1/vaults", nil, nil); err != nil {
+		return nil, fmt.Errorf("1password connect: %w", err)
+	}
+
+	return m, nil
+}
+
+// do sends a request to the Connect server and decodes the JSON response into out
+func (m *OnePasswordConnectManager) do(ctx context.Context, method, path string, body any, out any) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, m.host+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+m.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := m.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, apiErr.Message)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if raw, ok := out.(*[]byte); ok {
+		*raw, err = io.ReadAll(resp.Body)
+		return err
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+type connectRef struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Title string `json:"title"`
+}
+
+// lookupID finds the ID of the entry in list whose ID, name or title matches nameOrID
+func (m *OnePasswordConnectManager) lookupID(ctx context.Context, path, nameOrID string) (string, error) {
+	var list []connectRef
+	if err := m.do(ctx, http.MethodGet, path, nil, &list); err != nil {
+		return "", err
+	}
+	for _, e := range list {
+		if e.ID == nameOrID {
+			return e.ID, nil
+		}
+	}
+	for _, e := range list {
+		if e.Name == nameOrID || e.Title == nameOrID {
+			return e.ID, nil
+		}
+	}
+	return "", fmt.Errorf("%q not found", nameOrID)
+}
+
+// getItem fetches the raw item so unknown attributes survive a round trip
+func (m *OnePasswordConnectManager) getItem(ctx context.Context, vault, item string) (vaultID, itemID string, raw map[string]json.RawMessage, err error) {
+	vaultID, err = m.lookupID(ctx, "/v1/vaults", vault)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("vault: %w", err)
+	}
+	itemID, err = m.lookupID(ctx, "/v1/vaults/"+url.PathEscape(vaultID)+"/items", item)
+	if err != nil {
+		return "", "", nil, fmt.Errorf("item: %w", err)
+	}
+	if err := m.do(ctx, http.MethodGet, "/v1/vaults/"+url.PathEscape(vaultID)+"/items/"+url.PathEscape(itemID), nil, &raw); err != nil {
+		return "", "", nil, err
+	}
+	return vaultID, itemID, raw, nil
+}
+
+// parseConnectReference splits "op://vault/item/[section/]field"
+func parseConnectReference(reference string) (vault, item, section, field string, err error) {
+	if !strings.HasPrefix(reference, "op://") {
+		return "", "", "", "", fmt.Errorf("invalid reference format: must start with op://")
+	}
+	parts := strings.Split(strings.TrimPrefix(reference, "op://"), "/")
+	switch len(parts) {
+	case 3:
+		return parts[0], parts[1], "", parts[2], nil
+	case 4:
+		return parts[0], parts[1], parts[2], parts[3], nil
+	}
+	return "", "", "", "", fmt.Errorf("invalid reference format: expected op://vault/item/[section/]field")
+}
+
+// findField returns the index of the field matching id/label (and section, if given)
+func findField(fields []map[string]any, sectionIDs map[string]bool, name string) int {
+	for i, f := range fields {
+		if f["id"] != name && f["label"] != name {
+			continue
+		}
+		if sectionIDs != nil {
+			sec, _ := f["section"].(map[string]any)
+			if sec == nil || !sectionIDs[fmt.Sprint(sec["id"])] {
+				continue
+			}
+		}
+		return i
+	}
+	return -1
+}
+
+// sectionIDs returns the IDs of sections whose ID or label matches section, or nil if section is empty
+func sectionIDs(raw map[string]json.RawMessage, section string) map[string]bool {
+	if section == "" {
+		return nil
+	}
+	var sections []struct {
+		ID    string `json:"id"`
+		Label string `json:"label"`
+	}
+	json.Unmarshal(raw["sections"], &sections)
+	ids := make(map[string]bool)
+	for _, s := range sections {
+		if s.ID == section || s.Label == section {
+			ids[s.ID] = true
+		}
+	}
+	return ids
+}
+
+func (m *OnePasswordConnectManager) Resolve(ctx context.Context, reference string) (string, error) {
+	vault, item, section, field, err := parseConnectReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	vaultID, itemID, raw, err := m.getItem(ctx, vault, item)
+	if err != nil {
+		return "", fmt.Errorf("failed to get item: %w", err)
+	}
+
+	var fields []map[string]any
+	json.Unmarshal(raw["fields"], &fields)
+	if idx := findField(fields, sectionIDs(raw, section), field); idx != -1 {
+		val, _ := fields[idx]["value"].(string)
+		return val, nil
+	}
+
+	var files []struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	json.Unmarshal(raw["files"], &files)
+	for _, f := range files {
+		if f.ID == field || f.Name == field {
+			var content []byte
+			path := fmt.Sprintf("/v1/vaults/%s/items/%s/files/%s/content", url.PathEscape(vaultID), url.PathEscape(itemID), url.PathEscape(f.ID))
+			if err := m.do(ctx, http.MethodGet, path, nil, &content); err != nil {
+				return "", fmt.Errorf("failed to read file: %w", err)
+			}
+			return string(content), nil
+		}
+	}
+
+	return "", fmt.Errorf("field %q not found in item", field)
+}
+
+func (m *OnePasswordConnectManager) Write(ctx context.Context, reference string, value string) error {
+	vault, item, section, field, err := parseConnectReference(reference)
+	if err != nil {
+		return err
+	}
+
+	vaultID, itemID, raw, err := m.getItem(ctx, vault, item)
+	if err != nil {
+		return fmt.Errorf("failed to get item: %w", err)
+	}
+
+	var fields []map[string]any
+	json.Unmarshal(raw["fields"], &fields)
+
+	fieldIdx := findField(fields, sectionIDs(raw, section), field)
+	if fieldIdx == -1 {
+		return fmt.Errorf("field %q not found in item (file attachments cannot be written through Connect)", field)
+	}
+
+	// Keep the old value in <field>_previous, as the SDK manager does
+	prevFieldID := field + "_previous"
+	oldValue := fields[fieldIdx]["value"]
+	if prevIdx := findField(fields, nil, prevFieldID); prevIdx != -1 {
+		fields[prevIdx]["value"] = oldValue
+	} else {
+		prev := map[string]any{
+			"id":    prevFieldID,
+			"label": prevFieldID,
+			"type":  fields[fieldIdx]["type"],
+			"value": oldValue,
+		}
+		if sec, ok := fields[fieldIdx]["section"]; ok {
+			prev["section"] = sec
+		}
+		fields = append(fields, prev)
+	}
+	fields[fieldIdx]["value"] = value
+
+	if raw["fields"], err = json.Marshal(fields); err != nil {
+		return err
+	}
+
+	path := "/v1/vaults/" + url.PathEscape(vaultID) + "/items/" + url.PathEscape(itemID)
+	if err := m.do(ctx, http.MethodPut, path, raw, nil); err != nil {
+		return fmt.Errorf("failed to update item: %w", err)
+	}
+	return nil
+}
+
+func (m *OnePasswordConnectManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *OnePasswordConnectManager) Name() string {
+	return "1password-connect"
+}
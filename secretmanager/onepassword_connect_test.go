@@ -0,0 +1,143 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newFakeConnect serves a single vault "Infra" containing item "Database"
+func newFakeConnect(t *testing.T, token string) (*httptest.Server, *map[string]any) {
+	item := map[string]any{
+		"id":       "item1",
+		"title":    "Database",
+		"vault":    map[string]any{"id": "vault1"},
+		"category": "DATABASE",
+		"tags":     []any{"prod"},
+		"sections": []any{map[string]any{"id": "sec1", "label": "replica"}},
+		"fields": []any{
+			map[string]any{"id": "password", "label": "password", "type": "CONCEALED", "value": "hunter2"},
+			map[string]any{"id": "rpw", "label": "password", "type": "CONCEALED", "value": "replica-pw", "section": map[string]any{"id": "sec1"}},
+		},
+		"files": []any{map[string]any{"id": "file1", "name": "ca.pem"}},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/vaults", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]any{map[string]any{"id": "vault1", "name": "Infra"}})
+	})
+	mux.HandleFunc("GET /v1/vaults/vault1/items", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]any{map[string]any{"id": "item1", "title": "Database"}})
+	})
+	mux.HandleFunc("GET /v1/vaults/vault1/items/item1", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(item)
+	})
+	mux.HandleFunc("PUT /v1/vaults/vault1/items/item1", func(w http.ResponseWriter, r *http.Request) {
+		item = nil
+		if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+			http.Error(w, `{"message":"bad body"}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(item)
+	})
+	mux.HandleFunc("GET /v1/vaults/vault1/items/item1/files/file1/content", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("-----BEGIN CERTIFICATE-----"))
+	})
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+token {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"status":401,"message":"Invalid token signature"}`))
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &item
+}
+
+func TestConnectResolveAndWrite(t *testing.T) {
+	srv, item := newFakeConnect(t, "connect-token")
+	ctx := context.Background()
+
+	if _, err := NewOnePasswordConnectManager(ctx, nil, OnePasswordConnectConfig{Host: srv.URL, Token: "wrong"}); err == nil {
+		t.Fatal("expected bad token to fail")
+	}
+
+	m, err := NewOnePasswordConnectManager(ctx, nil, OnePasswordConnectConfig{Host: srv.URL, Token: "connect-token"})
+	if err != nil {
+		t.Fatalf("NewOnePasswordConnectManager: %v", err)
+	}
+
+	tests := map[string]string{
+		"op://Infra/Database/password":         "hunter2",
+		"op://vault1/item1/password":           "hunter2",
+		"op://Infra/Database/replica/password": "replica-pw",
+		"op://Infra/Database/ca.pem":           "-----BEGIN CERTIFICATE-----",
+	}
+	for ref, want := range tests {
+		got, err := m.Resolve(ctx, ref)
+		if err != nil {
+			t.Errorf("Resolve(%s): %v", ref, err)
+		} else if got != want {
+			t.Errorf("Resolve(%s): got %q, want %q", ref, got, want)
+		}
+	}
+
+	if err := m.Write(ctx, "op://Infra/Database/password", "correct-horse"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if got, _ := m.Resolve(ctx, "op://Infra/Database/password"); got != "correct-horse" {
+		t.Errorf("Resolve after write: got %q", got)
+	}
+	if got, _ := m.Resolve(ctx, "op://Infra/Database/password_previous"); got != "hunter2" {
+		t.Errorf("backup field: got %q, want %q", got, "hunter2")
+	}
+	if tags, _ := (*item)["tags"].([]any); len(tags) != 1 {
+		t.Errorf("unrelated item attributes lost on write: %v", *item)
+	}
+
+	if err := m.Write(ctx, "op://Infra/Database/ca.pem", "x"); err == nil {
+		t.Error("expected writing a file attachment to fail")
+	}
+}
+
+func TestConnectTokenFile(t *testing.T) {
+	srv, _ := newFakeConnect(t, "file-token")
+
+	tokenFile := filepath.Join(t.TempDir(), "connect-token")
+	if err := os.WriteFile(tokenFile, []byte("file-token\n"), 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	cfg := OnePasswordConnectConfig{Host: srv.URL, TokenFile: tokenFile}
+	if _, err := NewOnePasswordConnectManager(ctx, nil, cfg); err == nil {
+		t.Fatal("expected group-readable token file to be rejected")
+	}
+
+	os.Chmod(tokenFile, 0600)
+	if _, err := NewOnePasswordConnectManager(ctx, nil, cfg); err != nil {
+		t.Fatalf("NewOnePasswordConnectManager: %v", err)
+	}
+}
+
+func TestServiceAccountToken(t *testing.T) {
+	t.Setenv("OP_SERVICE_ACCOUNT_TOKEN", "from-env")
+
+	if token, _ := serviceAccountToken(OnePasswordConfig{ServiceAccountToken: "inline"}); token != "inline" {
+		t.Errorf("inline token: got %q", token)
+	}
+	if token, _ := serviceAccountToken(OnePasswordConfig{}); token != "from-env" {
+		t.Errorf("env token: got %q", token)
+	}
+
+	t.Setenv("OP_SERVICE_ACCOUNT_TOKEN", "")
+	if _, err := serviceAccountToken(OnePasswordConfig{}); err == nil {
+		t.Error("expected error without any token")
+	}
+}
@@ -0,0 +1,283 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/1password/onepassword-sdk-go"
+	"gopkg.in/yaml.v3"
+)
+
+// itemDocument is the structured form of a whole 1Password item, as exported
+// for "op://vault/item" references.
+type itemDocument struct {
+	ID       string           `json:"id" yaml:"id"`
+	Title    string           `json:"title" yaml:"title"`
+	Vault    string           `json:"vault" yaml:"vault"`
+	Category string           `json:"category" yaml:"category"`
+	Tags     []string         `json:"tags,omitempty" yaml:"tags,omitempty"`
+	URLs     []itemDocURL     `json:"urls,omitempty" yaml:"urls,omitempty"`
+	Notes    string           `json:"notes,omitempty" yaml:"notes,omitempty"`
+	Fields   []itemDocField   `json:"fields,omitempty" yaml:"fields,omitempty"`
+	Sections []itemDocSection `json:"sections,omitempty" yaml:"sections,omitempty"`
+}
+
+type itemDocURL struct {
+	Label string `json:"label,omitempty" yaml:"label,omitempty"`
+	Href  string `json:"href" yaml:"href"`
+}
+
+type itemDocField struct {
+	ID    string `json:"id" yaml:"id"`
+	Title string `json:"title" yaml:"title"`
+	Type  string `json:"type" yaml:"type"`
+	Value string `json:"value" yaml:"value"`
+}
+
+type itemDocSection struct {
+	ID     string         `json:"id" yaml:"id"`
+	Title  string         `json:"title" yaml:"title"`
+	Fields []itemDocField `json:"fields" yaml:"fields"`
+}
+
+// parseItemReference recognizes "op://vault/item[?format=json|yaml]", which
+// refers to a whole item rather than one field.
+func parseItemReference(reference string) (vault, item, format string, ok bool, err error) {
+	if !strings.HasPrefix(reference, "op://") {
+		return "", "", "", false, nil
+	}
+	path, query, _ := strings.Cut(strings.TrimPrefix(reference, "op://"), "?")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", "", false, nil
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", "", true, fmt.Errorf("invalid reference query: %w", err)
+	}
+	format = values.Get("format")
+	switch format {
+	case "":
+		format = "json"
+	case "json", "yaml":
+	default:
+		return "", "", "", true, fmt.Errorf("unsupported item format %q (use json or yaml)", format)
+	}
+	return parts[0], parts[1], format, true, nil
+}
+
+// findItem looks up an item by vault and item title or ID
+func findItem(ctx context.Context, l opLister, vault, item string) (onepassword.VaultOverview, onepassword.Item, error) {
+	vaults, err := l.vaults(ctx)
+	if err != nil {
+		return onepassword.VaultOverview{}, onepassword.Item{}, fmt.Errorf("failed to list vaults: %w", err)
+	}
+	i := slices.IndexFunc(vaults, func(v onepassword.VaultOverview) bool { return v.ID == vault || v.Title == vault })
+	if i == -1 {
+		return onepassword.VaultOverview{}, onepassword.Item{}, fmt.Errorf("vault %q not found", vault)
+	}
+	v := vaults[i]
+
+	overviews, err := l.items(ctx, v.ID)
+	if err != nil {
+		return v, onepassword.Item{}, fmt.Errorf("failed to list items in %s: %w", v.Title, err)
+	}
+	j := slices.IndexFunc(overviews, func(o onepassword.ItemOverview) bool { return o.ID == item || o.Title == item })
+	if j == -1 {
+		return v, onepassword.Item{}, fmt.Errorf("item %q not found in %s", item, v.Title)
+	}
+	it, err := l.item(ctx, v.ID, overviews[j].ID)
+	if err != nil {
+		return v, onepassword.Item{}, fmt.Errorf("failed to get item: %w", err)
+	}
+	return v, it, nil
+}
+
+func newItemDocument(vault onepassword.VaultOverview, item onepassword.Item) itemDocument {
+	doc := itemDocument{
+		ID:       item.ID,
+		Title:    item.Title,
+		Vault:    vault.Title,
+		Category: string(item.Category),
+		Tags:     item.Tags,
+		Notes:    item.Notes,
+	}
+	for _, w := range item.Websites {
+		doc.URLs = append(doc.URLs, itemDocURL{Label: w.Label, Href: w.URL})
+	}
+	for _, section := range item.Sections {
+		doc.Sections = append(doc.Sections, itemDocSection{ID: section.ID, Title: section.Title, Fields: []itemDocField{}})
+	}
+	for _, field := range item.Fields {
+		f := itemDocField{ID: field.ID, Title: field.Title, Type: string(field.FieldType), Value: field.Value}
+		if i := sectionIndex(doc.Sections, field.SectionID); i != -1 {
+			doc.Sections[i].Fields = append(doc.Sections[i].Fields, f)
+		} else {
+			doc.Fields = append(doc.Fields, f)
+		}
+	}
+	return doc
+}
+
+func sectionIndex(sections []itemDocSection, id *string) int {
+	if id == nil {
+		return -1
+	}
+	return slices.IndexFunc(sections, func(s itemDocSection) bool { return s.ID == *id })
+}
+
+func marshalItemDocument(doc itemDocument, format string) (string, error) {
+	if format == "yaml" {
+		out, err := yaml.Marshal(doc)
+		return string(out), err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func unmarshalItemDocument(value, format string) (itemDocument, error) {
+	var doc itemDocument
+	var err error
+	if format == "yaml" {
+		err = yaml.Unmarshal([]byte(value), &doc)
+	} else {
+		err = json.Unmarshal([]byte(value), &doc)
+	}
+	if err != nil {
+		return doc, fmt.Errorf("invalid item document: %w", err)
+	}
+	return doc, nil
+}
+
+// applyItemDocument updates item from an edited document. Changed field
+// values are backed up like single-field writes; identity, field layout and
+// types can't be changed this way.
+func applyItemDocument(item onepassword.Item, doc itemDocument) (onepassword.Item, bool, error) {
+	if doc.ID != item.ID || doc.Category != string(item.Category) {
+		return item, false, fmt.Errorf("id and category of item %s are read-only", item.ID)
+	}
+
+	fields := slices.Clone(doc.Fields)
+	for _, section := range doc.Sections {
+		fields = append(fields, section.Fields...)
+	}
+	// Backups are appended as new fields, so only existing ones are compared
+	existing := len(item.Fields)
+	if len(fields) != existing {
+		return item, false, fmt.Errorf("adding or removing fields of item %s is not supported", item.ID)
+	}
+
+	// Values are compared with the item as read, since backing up a field
+	// overwrites its _previous field before that one is reached
+	edited := make(map[string]bool)
+	for _, f := range fields {
+		i := slices.IndexFunc(item.Fields, func(field onepassword.ItemField) bool { return field.ID == f.ID })
+		if i == -1 {
+			return item, false, fmt.Errorf("field %q not found in item", f.ID)
+		}
+		if f.Type != string(item.Fields[i].FieldType) {
+			return item, false, fmt.Errorf("type of field %q is read-only", f.ID)
+		}
+		if f.Value != item.Fields[i].Value {
+			edited[f.ID] = true
+		}
+	}
+
+	item.Fields = slices.Clone(item.Fields)
+	changed := false
+	for _, f := range fields {
+		i := slices.IndexFunc(item.Fields[:existing], func(field onepassword.ItemField) bool { return field.ID == f.ID })
+		if f.Title != item.Fields[i].Title {
+			item.Fields[i].Title = f.Title
+			changed = true
+		}
+		if !edited[f.ID] {
+			continue
+		}
+		// The backup of a changed field takes precedence over edits to it
+		if base, ok := strings.CutSuffix(f.ID, "_previous"); ok && edited[base] {
+			continue
+		}
+		if err := setFieldWithBackup(&item, f.ID, f.Value); err != nil {
+			return item, false, err
+		}
+		changed = true
+	}
+
+	if doc.Title != item.Title {
+		item.Title = doc.Title
+		changed = true
+	}
+	if doc.Notes != item.Notes {
+		item.Notes = doc.Notes
+		changed = true
+	}
+	if !slices.Equal(doc.Tags, item.Tags) && (len(doc.Tags) > 0 || len(item.Tags) > 0) {
+		item.Tags = doc.Tags
+		changed = true
+	}
+
+	websites := make([]onepassword.Website, 0, len(doc.URLs))
+	for i, u := range doc.URLs {
+		w := onepassword.Website{URL: u.Href, Label: u.Label, AutofillBehavior: onepassword.AutofillBehaviorAnywhereOnWebsite}
+		if i < len(item.Websites) {
+			w.AutofillBehavior = item.Websites[i].AutofillBehavior
+		}
+		websites = append(websites, w)
+	}
+	if !slices.Equal(websites, item.Websites) && (len(websites) > 0 || len(item.Websites) > 0) {
+		item.Websites = websites
+		changed = true
+	}
+
+	return item, changed, nil
+}
+
+func (m *OnePasswordManager) resolveItem(ctx context.Context, reference, vault, itemName, format string) (string, error) {
+	client, err := m.clientFor(ctx, reference)
+	if err != nil {
+		return "", err
+	}
+	v, item, err := findItem(ctx, sdkLister{client}, vault, itemName)
+	if err != nil {
+		return "", err
+	}
+	return marshalItemDocument(newItemDocument(v, item), format)
+}
+
+func (m *OnePasswordManager) writeItem(ctx context.Context, reference, vault, itemName, format, value string) error {
+	doc, err := unmarshalItemDocument(value, format)
+	if err != nil {
+		return err
+	}
+
+	client, err := m.clientFor(ctx, reference)
+	if err != nil {
+		return err
+	}
+	_, item, err := findItem(ctx, sdkLister{client}, vault, itemName)
+	if err != nil {
+		return err
+	}
+
+	item, changed, err := applyItemDocument(item, doc)
+	if err != nil || !changed {
+		return err
+	}
+	if _, err := client.Items().Put(ctx, item); err != nil {
+		return fmt.Errorf("failed to update item: %w", err)
+	}
+	return nil
+}
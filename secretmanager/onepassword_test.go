@@ -0,0 +1,342 @@
+package secretmanager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/1password/onepassword-sdk-go"
+)
+
+type fakeLister struct {
+	vaultList []onepassword.VaultOverview
+	itemList  map[string][]onepassword.Item // by vault ID
+}
+
+func (l *fakeLister) vaults(ctx context.Context) ([]onepassword.VaultOverview, error) {
+	return l.vaultList, nil
+}
+
+func (l *fakeLister) items(ctx context.Context, vaultID string) ([]onepassword.ItemOverview, error) {
+	var overviews []onepassword.ItemOverview
+	for _, item := range l.itemList[vaultID] {
+		overviews = append(overviews, onepassword.ItemOverview{ID: item.ID, Title: item.Title, VaultID: vaultID})
+	}
+	return overviews, nil
+}
+
+func (l *fakeLister) item(ctx context.Context, vaultID, itemID string) (onepassword.Item, error) {
+	for _, item := range l.itemList[vaultID] {
+		if item.ID == itemID {
+			return item, nil
+		}
+	}
+	return onepassword.Item{}, nil
+}
+
+func TestExpandOnePassword(t *testing.T) {
+	section := "sec1"
+	l := &fakeLister{
+		vaultList: []onepassword.VaultOverview{{ID: "v1", Title: "Prod"}, {ID: "v2", Title: "Dev"}},
+		itemList: map[string][]onepassword.Item{
+			"v1": {
+				{ID: "i1", Title: "Database", Fields: []onepassword.ItemField{
+					{ID: "username", Title: "username", Value: "app"},
+					{ID: "password", Title: "password", Value: "s3cret"},
+					{ID: "f3", Title: "port", SectionID: &section},
+				}, Sections: []onepassword.ItemSection{{ID: "sec1", Title: "Connection"}}},
+				{ID: "i2", Title: "API", Fields: []onepassword.ItemField{
+					{ID: "password", Title: "password", Value: "t0k3n"},
+				}},
+			},
+			"v2": {
+				{ID: "i3", Title: "Database", Fields: []onepassword.ItemField{
+					{ID: "password", Title: "password"},
+				}},
+			},
+		},
+	}
+	ctx := context.Background()
+
+	tests := []struct {
+		pattern string
+		want    []Expansion
+	}{
+		{"op://Prod/*/password", []Expansion{
+			{Reference: "op://v1/i1/password", Path: []string{"Database", "password"}},
+			{Reference: "op://v1/i2/password", Path: []string{"API", "password"}},
+		}},
+		{"op://Prod/Database/*", []Expansion{
+			{Reference: "op://v1/i1/username", Path: []string{"username"}},
+			{Reference: "op://v1/i1/password", Path: []string{"password"}},
+			{Reference: "op://v1/i1/f3", Path: []string{"port"}},
+		}},
+		{"op://Prod/Database/Connection/*", []Expansion{
+			{Reference: "op://v1/i1/sec1/f3", Path: []string{"port"}},
+		}},
+		{"op://*/Database/password", []Expansion{
+			{Reference: "op://v1/i1/password", Path: []string{"Prod", "Database", "password"}},
+			{Reference: "op://v2/i3/password", Path: []string{"Dev", "Database", "password"}},
+		}},
+	}
+	for _, tt := range tests {
+		got, err := expandOnePassword(ctx, l, tt.pattern)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.pattern, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %v\nwant %v", tt.pattern, got, tt.want)
+		}
+	}
+
+	for _, pattern := range []string{"op://Prod/*", "op://Prod/Database/password", "vault://*/x/y"} {
+		if _, err := expandOnePassword(ctx, l, pattern); err == nil {
+			t.Errorf("%s: expected error", pattern)
+		}
+	}
+}
+
+func TestParseReferenceSection(t *testing.T) {
+	if v, i, f, err := parseReference("op://v/i/section/field"); err != nil || v != "v" || i != "i" || f != "field" {
+		t.Errorf("got %q %q %q %v", v, i, f, err)
+	}
+}
+
+func TestParseItemReference(t *testing.T) {
+	if v, i, f, ok, err := parseItemReference("op://Prod/Database?format=yaml"); !ok || err != nil || v != "Prod" || i != "Database" || f != "yaml" {
+		t.Errorf("got %q %q %q %v %v", v, i, f, ok, err)
+	}
+	if _, _, f, ok, _ := parseItemReference("op://Prod/Database"); !ok || f != "json" {
+		t.Errorf("default format: got %q %v", f, ok)
+	}
+	if _, _, _, ok, err := parseItemReference("op://Prod/Database?format=toml"); !ok || err == nil {
+		t.Error("expected unsupported format to fail")
+	}
+	for _, ref := range []string{"op://Prod/Database/password", "op://Prod", "vault://a/b"} {
+		if _, _, _, ok, _ := parseItemReference(ref); ok {
+			t.Errorf("%s: should not be an item reference", ref)
+		}
+	}
+}
+
+func TestItemDocumentRoundTrip(t *testing.T) {
+	section := "sec1"
+	l := &fakeLister{
+		vaultList: []onepassword.VaultOverview{{ID: "v1", Title: "Prod"}},
+		itemList: map[string][]onepassword.Item{"v1": {{
+			ID: "i1", Title: "Database", Category: onepassword.ItemCategoryLogin, VaultID: "v1",
+			Tags:     []string{"db"},
+			Websites: []onepassword.Website{{URL: "https://db.example.com", Label: "website", AutofillBehavior: onepassword.AutofillBehaviorNever}},
+			Fields: []onepassword.ItemField{
+				{ID: "username", Title: "username", FieldType: onepassword.ItemFieldTypeText, Value: "app"},
+				{ID: "password", Title: "password", FieldType: onepassword.ItemFieldTypeConcealed, Value: "old"},
+				{ID: "f3", Title: "port", FieldType: onepassword.ItemFieldTypeText, Value: "5432", SectionID: &section},
+			},
+			Sections: []onepassword.ItemSection{{ID: "sec1", Title: "Connection"}},
+		}}},
+	}
+	ctx := context.Background()
+
+	v, item, err := findItem(ctx, l, "Prod", "Database")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := findItem(ctx, l, "Prod", "Missing"); err == nil {
+		t.Error("expected missing item to fail")
+	}
+
+	for _, format := range []string{"json", "yaml"} {
+		out, err := marshalItemDocument(newItemDocument(v, item), format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		doc, err := unmarshalItemDocument(out, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(doc.Fields) != 2 || len(doc.Sections) != 1 || doc.Sections[0].Fields[0].Value != "5432" || doc.URLs[0].Href != "https://db.example.com" {
+			t.Errorf("%s: unexpected document %+v", format, doc)
+		}
+		if _, changed, err := applyItemDocument(item, doc); err != nil || changed {
+			t.Errorf("%s: unedited document should not change the item: %v %v", format, changed, err)
+		}
+	}
+
+	doc := newItemDocument(v, item)
+	doc.Fields[1].Value = "new"
+	doc.Sections[0].Fields[0].Value = "6543"
+	doc.Notes = "rotated"
+	updated, changed, err := applyItemDocument(item, doc)
+	if err != nil || !changed {
+		t.Fatalf("apply: %v %v", changed, err)
+	}
+	values := map[string]string{}
+	for _, f := range updated.Fields {
+		values[f.ID] = f.Value
+	}
+	want := map[string]string{"username": "app", "password": "new", "password_previous": "old", "f3": "6543", "f3_previous": "5432"}
+	if !reflect.DeepEqual(values, want) || updated.Notes != "rotated" {
+		t.Errorf("got %v notes %q", values, updated.Notes)
+	}
+	if updated.Websites[0].AutofillBehavior != onepassword.AutofillBehaviorNever {
+		t.Error("autofill behavior should be kept")
+	}
+	if item.Fields[1].Value != "old" {
+		t.Error("original item should not be modified")
+	}
+
+	// An existing backup is replaced, not restored from the document
+	doc = newItemDocument(v, updated)
+	doc.Fields[1].Value = "newer"
+	again, _, err := applyItemDocument(updated, doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values = map[string]string{}
+	for _, f := range again.Fields {
+		values[f.ID] = f.Value
+	}
+	want = map[string]string{"username": "app", "password": "newer", "password_previous": "new", "f3": "6543", "f3_previous": "5432"}
+	if !reflect.DeepEqual(values, want) {
+		t.Errorf("second apply: got %v, want %v", values, want)
+	}
+
+	doc = newItemDocument(v, item)
+	doc.Fields = doc.Fields[:1]
+	if _, _, err := applyItemDocument(item, doc); err == nil {
+		t.Error("expected removing a field to fail")
+	}
+	doc = newItemDocument(v, item)
+	doc.Fields[0].Type = "Concealed"
+	if _, _, err := applyItemDocument(item, doc); err == nil {
+		t.Error("expected changing a field type to fail")
+	}
+}
+
+func TestOnePasswordClientPool(t *testing.T) {
+	var mu sync.Mutex
+	dials := map[string]int{}
+	block := make(chan struct{})
+	fail := true
+	m := &OnePasswordManager{
+		clients: make(map[string]*opClient),
+		dial: func(ctx context.Context, account string) (*onepassword.Client, error) {
+			mu.Lock()
+			dials[account]++
+			failing := account == "flaky" && fail
+			mu.Unlock()
+			if account == "slow" {
+				<-block
+			}
+			if failing {
+				return nil, errors.New("app locked")
+			}
+			return &onepassword.Client{}, nil
+		},
+	}
+	ctx := context.Background()
+
+	// A client still being created must not hold up other accounts
+	slow := make(chan *onepassword.Client, 2)
+	for range 2 {
+		go func() {
+			c, _ := m.clientForAccount(ctx, "slow")
+			slow <- c
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		m.clientForAccount(ctx, "fast")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fast account blocked behind slow one")
+	}
+	close(block)
+	if a, b := <-slow, <-slow; a == nil || a != b {
+		t.Errorf("concurrent callers got different clients: %p, %p", a, b)
+	}
+
+	first, _ := m.clientForAccount(ctx, "fast")
+	second, _ := m.clientForAccount(ctx, "fast")
+	if first != second {
+		t.Error("client not reused")
+	}
+
+	// A failed client is retried rather than cached
+	if _, err := m.clientForAccount(ctx, "flaky"); err == nil {
+		t.Error("expected error")
+	}
+	mu.Lock()
+	fail = false
+	mu.Unlock()
+	if c, err := m.clientForAccount(ctx, "flaky"); err != nil || c == nil {
+		t.Errorf("retry: %v", err)
+	}
+
+	want := map[string]int{"slow": 1, "fast": 1, "flaky": 2}
+	if !reflect.DeepEqual(dials, want) {
+		t.Errorf("dials = %v, want %v", dials, want)
+	}
+}
+
+func TestOnePasswordClientRouting(t *testing.T) {
+	clients := map[string]*onepassword.Client{}
+	m := &OnePasswordManager{
+		account: "personal",
+		accounts: map[string]string{
+			"op://Work/db/password": "work",
+			"op://Home/wifi/psk":    "",
+		},
+		clients: make(map[string]*opClient),
+		dial: func(ctx context.Context, account string) (*onepassword.Client, error) {
+			c := &onepassword.Client{}
+			clients[account] = c
+			return c, nil
+		},
+	}
+	ctx := context.Background()
+
+	for ref, account := range map[string]string{
+		"op://Work/db/password": "work",
+		"op://Home/wifi/psk":    "personal",
+		"op://Other/x/y":        "personal",
+	} {
+		c, err := m.clientFor(ctx, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c != clients[account] {
+			t.Errorf("%s: not routed to %s", ref, account)
+		}
+	}
+}
+
+func TestOnePasswordTokenWithOverrides(t *testing.T) {
+	t.Setenv("OP_SERVICE_ACCOUNT_TOKEN", "")
+	refs := []string{"op://Work/db/password"}
+	accounts := map[string]string{"op://Work/db/password": "work"}
+
+	// Every secret overrides the account, but the token still serves the default
+	m, err := NewOnePasswordManager(context.Background(), refs, OnePasswordConfig{Accounts: accounts, ServiceAccountToken: "ops_token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.token != "ops_token" {
+		t.Errorf("token = %q", m.token)
+	}
+
+	// Without a token the default account is unusable, which is only an error once it's needed
+	m, err = NewOnePasswordManager(context.Background(), refs, OnePasswordConfig{Accounts: accounts})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.clientForAccount(context.Background(), ""); !errors.Is(err, errNoToken) {
+		t.Errorf("default client: got %v, want errNoToken", err)
+	}
+}
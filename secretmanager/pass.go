@@ -0,0 +1,250 @@
+package secretmanager
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PassConfig configures access to a password-store (pass) directory
+type PassConfig struct {
+	StoreDir  string // defaults to PASSWORD_STORE_DIR or ~/.password-store
+	GPGBinary string // defaults to "gpg"
+}
+
+// PassManager resolves pass://path/to/entry[#line-or-key] references by
+// decrypting entries with gpg, so gpg-agent handles keys and pinentry.
+type PassManager struct {
+	storeDir string
+	gpg      string
+}
+
+func NewPassManager(ctx context.Context, cfg PassConfig) (*PassManager, error) {
+	storeDir := cfg.StoreDir
+	if storeDir == "" {
+		storeDir = os.Getenv("PASSWORD_STORE_DIR")
+	}
+	if storeDir == "" {
+		storeDir = "~/.password-store"
+	}
+	storeDir = expandHome(storeDir)
+
+	if _, err := os.Stat(filepath.Join(storeDir, ".gpg-id")); err != nil {
+		return nil, fmt.Errorf("password store %s is not initialized: %w", storeDir, err)
+	}
+
+	gpg := cfg.GPGBinary
+	if gpg == "" {
+		gpg = "gpg"
+	}
+	if _, err := exec.LookPath(gpg); err != nil {
+		return nil, fmt.Errorf("gpg not found: %w", err)
+	}
+
+	return &PassManager{
+		storeDir: storeDir,
+		gpg:      gpg,
+	}, nil
+}
+
+// parsePassReference extracts the entry path and optional fragment from "pass://path#fragment"
+func parsePassReference(reference string) (entry, fragment string, err error) {
+	if !strings.HasPrefix(reference, "pass://") {
+		return "", "", fmt.Errorf("invalid reference format: must start with pass://")
+	}
+	entry, fragment, _ = strings.Cut(strings.TrimPrefix(reference, "pass://"), "#")
+	entry = strings.Trim(entry, "/")
+	if entry == "" || entry != filepath.Clean(entry) || strings.HasPrefix(entry, "..") {
+		return "", "", fmt.Errorf("invalid reference format: expected pass://path/to/entry[#line-or-key]")
+	}
+	return entry, fragment, nil
+}
+
+func (m *PassManager) entryFile(entry string) string {
+	return filepath.Join(m.storeDir, entry+".gpg")
+}
+
+func (m *PassManager) decrypt(ctx context.Context, file string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, m.gpg, "--quiet", "--batch", "--yes", "--decrypt", file)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("gpg decrypt %s: %w: %s", file, err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+// recipients reads the nearest .gpg-id between the entry's directory and the store root
+func (m *PassManager) recipients(entry string) ([]string, error) {
+	dir := filepath.Dir(m.entryFile(entry))
+	for {
+		data, err := os.ReadFile(filepath.Join(dir, ".gpg-id"))
+		if err == nil {
+			var ids []string
+			scanner := bufio.NewScanner(bytes.NewReader(data))
+			for scanner.Scan() {
+				line, _, _ := strings.Cut(scanner.Text(), "#")
+				if line = strings.TrimSpace(line); line != "" {
+					ids = append(ids, line)
+				}
+			}
+			if len(ids) == 0 {
+				return nil, fmt.Errorf("%s has no recipients", filepath.Join(dir, ".gpg-id"))
+			}
+			return ids, nil
+		}
+		if dir == m.storeDir || !strings.HasPrefix(dir, m.storeDir) {
+			return nil, fmt.Errorf("no .gpg-id found for %s", entry)
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (m *PassManager) encrypt(ctx context.Context, entry string, content []byte) error {
+	recipients, err := m.recipients(entry)
+	if err != nil {
+		return err
+	}
+
+	file := m.entryFile(entry)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+
+	// Encrypt next to the entry and rename so readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(file), ".secrets-fuse-*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpName)
+
+	args := []string{"--quiet", "--batch", "--yes", "--no-encrypt-to", "--compress-algo=none", "--encrypt", "--output", tmpName}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, m.gpg, args...)
+	cmd.Stdin = bytes.NewReader(content)
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("gpg encrypt %s: %w: %s", entry, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return os.Rename(tmpName, file)
+}
+
+// selectLine finds the line addressed by fragment: a 1-based line number or a "key:" prefix
+func selectLine(lines []string, fragment string) (int, string, bool) {
+	if n, err := strconv.Atoi(fragment); err == nil {
+		if n < 1 || n > len(lines) {
+			return -1, "", false
+		}
+		return n - 1, lines[n-1], true
+	}
+	for i, line := range lines {
+		key, val, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(key), fragment) {
+			return i, strings.TrimSpace(val), true
+		}
+	}
+	return -1, "", false
+}
+
+func (m *PassManager) Resolve(ctx context.Context, reference string) (string, error) {
+	entry, fragment, err := parsePassReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := m.decrypt(ctx, m.entryFile(entry))
+	if err != nil {
+		return "", err
+	}
+	if fragment == "" {
+		return string(content), nil
+	}
+
+	_, val, ok := selectLine(strings.Split(string(content), "\n"), fragment)
+	if !ok {
+		return "", fmt.Errorf("%q not found in %s", fragment, entry)
+	}
+	return val, nil
+}
+
+func (m *PassManager) Write(ctx context.Context, reference string, value string) error {
+	entry, fragment, err := parsePassReference(reference)
+	if err != nil {
+		return err
+	}
+
+	if fragment == "" {
+		return m.encrypt(ctx, entry, []byte(value))
+	}
+
+	// Editing a single line of a new entry creates it
+	var content []byte
+	if _, err := os.Stat(m.entryFile(entry)); err == nil {
+		if content, err = m.decrypt(ctx, m.entryFile(entry)); err != nil {
+			return err
+		}
+	}
+
+	lines := strings.Split(string(content), "\n")
+	idx, _, found := selectLine(lines, fragment)
+	if n, err := strconv.Atoi(fragment); err == nil {
+		if n < 1 {
+			return fmt.Errorf("invalid line number %d", n)
+		}
+		for len(lines) < n {
+			lines = append(lines, "")
+		}
+		lines[n-1] = value
+	} else if found {
+		key, _, _ := strings.Cut(lines[idx], ":")
+		lines[idx] = key + ": " + value
+	} else {
+		if lines[len(lines)-1] == "" {
+			lines = lines[:len(lines)-1]
+		}
+		lines = append(lines, fragment+": "+value, "")
+	}
+
+	return m.encrypt(ctx, entry, []byte(strings.Join(lines, "\n")))
+}
+
+func (m *PassManager) ListSecrets(ctx context.Context) ([]string, error) {
+	var refs []string
+	err := filepath.WalkDir(m.storeDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && strings.HasPrefix(d.Name(), ".") && path != m.storeDir {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".gpg") {
+			return nil
+		}
+		rel, err := filepath.Rel(m.storeDir, path)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, "pass://"+filepath.ToSlash(strings.TrimSuffix(rel, ".gpg")))
+		return nil
+	})
+	return refs, err
+}
+
+func (m *PassManager) Name() string {
+	return "pass"
+}
@@ -0,0 +1,114 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newTestPassStore creates a throwaway GNUPGHOME with one key and a store encrypted to it
+func newTestPassStore(t *testing.T) *PassManager {
+	t.Helper()
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+
+	gnupgHome, err := os.MkdirTemp("", "gnupg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+		os.RemoveAll(gnupgHome)
+	})
+	os.Chmod(gnupgHome, 0700)
+	t.Setenv("GNUPGHOME", gnupgHome)
+
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", "pass-test@example.com", "default", "default", "never")
+	if out, err := gen.CombinedOutput(); err != nil {
+		t.Fatalf("generating key: %v: %s", err, out)
+	}
+
+	storeDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(storeDir, ".gpg-id"), []byte("pass-test@example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewPassManager(context.Background(), PassConfig{StoreDir: storeDir})
+	if err != nil {
+		t.Fatalf("NewPassManager: %v", err)
+	}
+	return m
+}
+
+func TestPassResolveAndWrite(t *testing.T) {
+	m := newTestPassStore(t)
+	ctx := context.Background()
+
+	entry := "web/example.com"
+	if err := m.Write(ctx, "pass://"+entry, "s3cret\nlogin: alice\nurl: https://example.com\n"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	tests := map[string]string{
+		"pass://web/example.com#1":     "s3cret",
+		"pass://web/example.com#login": "alice",
+		"pass://web/example.com#URL":   "https://example.com",
+	}
+	for ref, want := range tests {
+		if got, err := m.Resolve(ctx, ref); err != nil || got != want {
+			t.Errorf("Resolve(%s): got %q, %v; want %q", ref, got, err, want)
+		}
+	}
+
+	if err := m.Write(ctx, "pass://web/example.com#1", "n3w"); err != nil {
+		t.Fatalf("Write line: %v", err)
+	}
+	if err := m.Write(ctx, "pass://web/example.com#otp", "123456"); err != nil {
+		t.Fatalf("Write key: %v", err)
+	}
+	got, err := m.Resolve(ctx, "pass://web/example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "n3w\nlogin: alice\nurl: https://example.com\notp: 123456\n"
+	if got != want {
+		t.Errorf("content after edits: got %q, want %q", got, want)
+	}
+
+	if _, err := m.Resolve(ctx, "pass://web/example.com#missing"); err == nil {
+		t.Error("expected error for missing key")
+	}
+}
+
+func TestPassSubdirRecipientsAndList(t *testing.T) {
+	m := newTestPassStore(t)
+	ctx := context.Background()
+
+	// A subfolder .gpg-id naming an unknown recipient must take precedence
+	os.MkdirAll(filepath.Join(m.storeDir, "team"), 0700)
+	os.WriteFile(filepath.Join(m.storeDir, "team", ".gpg-id"), []byte("nobody@example.com\n"), 0600)
+	if err := m.Write(ctx, "pass://team/db", "x"); err == nil {
+		t.Error("expected encryption to unknown subfolder recipient to fail")
+	}
+
+	m.Write(ctx, "pass://a", "1")
+	m.Write(ctx, "pass://dir/b", "2")
+
+	refs, err := m.ListSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(refs)
+	if want := []string{"pass://a", "pass://dir/b"}; !reflect.DeepEqual(refs, want) {
+		t.Errorf("ListSecrets: got %v, want %v", refs, want)
+	}
+
+	if _, err := m.Resolve(ctx, "pass://../etc/passwd"); err == nil {
+		t.Error("expected path traversal to be rejected")
+	}
+}
@@ -0,0 +1,308 @@
+package secretmanager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// PluginProtocolVersion is the version of the plugin protocol spoken by secrets-fuse
+const PluginProtocolVersion = 1
+
+// defaultPluginTimeout bounds a call whose context has no deadline
+const defaultPluginTimeout = 30 * time.Second
+
+// PluginConfig describes an external plugin executable
+type PluginConfig struct {
+	Command string
+	Args    []string
+	Env     map[string]string
+	Timeout time.Duration // per call, when the caller sets no deadline
+}
+
+// pluginError is an error object returned by the plugin
+type pluginError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *pluginError) Error() string {
+	return e.Message
+}
+
+// errPluginDesync means responses can no longer be matched to requests
+var errPluginDesync = errors.New("plugin protocol out of sync")
+
+// PluginCapabilities are announced by a plugin in its initialize response
+type PluginCapabilities struct {
+	Write bool `json:"write"`
+	List  bool `json:"list"`
+}
+
+// PluginInfo is the result of the initialize method
+type PluginInfo struct {
+	ProtocolVersion int                `json:"protocol_version"`
+	Name            string             `json:"name"`
+	Capabilities    PluginCapabilities `json:"capabilities"`
+}
+
+type pluginRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      uint64 `json:"id"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type pluginResponse struct {
+	ID     uint64          `json:"id"`
+	Result json.RawMessage `json:"result"`
+	Error  *pluginError    `json:"error"`
+}
+
+// PluginManager is a SecretManager backed by an external executable speaking
+// newline-delimited JSON-RPC 2.0 on stdin/stdout. The process is started on
+// construction and restarted if it exits.
+type PluginManager struct {
+	cfg     PluginConfig
+	secrets []string // configured secret references
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+	nextID uint64
+	info   PluginInfo
+}
+
+func NewPluginManager(ctx context.Context, secrets []string, cfg PluginConfig) (*PluginManager, error) {
+	m := &PluginManager{
+		cfg:     cfg,
+		secrets: secrets,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.start(ctx); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// start launches the plugin and negotiates the protocol. Must be called with m.mu held.
+func (m *PluginManager) start(ctx context.Context) error {
+	cmd := exec.Command(expandHome(m.cfg.Command), m.cfg.Args...)
+	cmd.Env = os.Environ()
+	for k, v := range m.cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("starting plugin %s: %w", m.cfg.Command, err)
+	}
+
+	m.cmd = cmd
+	m.stdin = stdin
+	m.stdout = bufio.NewReader(stdout)
+
+	var info PluginInfo
+	if err := m.call(ctx, "initialize", map[string]int{"protocol_version": PluginProtocolVersion}, &info); err != nil {
+		m.stop()
+		return fmt.Errorf("initializing plugin %s: %w", m.cfg.Command, err)
+	}
+	if info.ProtocolVersion != PluginProtocolVersion {
+		m.stop()
+		return fmt.Errorf("plugin %s speaks protocol version %d, want %d", m.cfg.Command, info.ProtocolVersion, PluginProtocolVersion)
+	}
+	// name is optional; older plugins only announce it in initialize
+	var named struct {
+		Name string `json:"name"`
+	}
+	var rpcErr *pluginError
+	if err := m.call(ctx, "name", nil, &named); err != nil && !errors.As(err, &rpcErr) {
+		m.stop()
+		return fmt.Errorf("initializing plugin %s: %w", m.cfg.Command, err)
+	}
+	if named.Name != "" {
+		info.Name = named.Name
+	}
+	if info.Name == "" {
+		info.Name = m.cfg.Command
+	}
+	m.info = info
+	return nil
+}
+
+// stop terminates the plugin process. Must be called with m.mu held.
+func (m *PluginManager) stop() {
+	if m.cmd == nil {
+		return
+	}
+	m.stdin.Close()
+	m.cmd.Process.Kill()
+	m.cmd.Wait()
+	m.cmd = nil
+}
+
+// call sends one request and waits for its response. A plugin that doesn't
+// answer in time or answers out of order is stopped, to be restarted by the
+// next call. Must be called with m.mu held.
+func (m *PluginManager) call(ctx context.Context, method string, params any, result any) error {
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := m.cfg.Timeout
+		if timeout <= 0 {
+			timeout = defaultPluginTimeout
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	m.nextID++
+	req := pluginRequest{JSONRPC: "2.0", ID: m.nextID, Method: method, Params: params}
+
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	type lineResult struct {
+		line []byte
+		err  error
+	}
+	// The write is covered by the timeout too, as a plugin that stops reading
+	// blocks it once the pipe is full. The pipes are captured because a
+	// restart replaces them before this goroutine may have run.
+	stdin, stdout := m.stdin, m.stdout
+	done := make(chan lineResult, 1)
+	go func() {
+		if _, err := stdin.Write(append(data, '\n')); err != nil {
+			done <- lineResult{nil, err}
+			return
+		}
+		line, err := stdout.ReadBytes('\n')
+		done <- lineResult{line, err}
+	}()
+
+	var line []byte
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return fmt.Errorf("plugin unavailable: %w", r.err)
+		}
+		line = r.line
+	case <-ctx.Done():
+		// The response can no longer be matched to a request, so start over
+		m.stop()
+		return fmt.Errorf("plugin %s: %s: %w", m.cfg.Command, method, ctx.Err())
+	}
+
+	var resp pluginResponse
+	if err := json.Unmarshal(line, &resp); err != nil {
+		m.stop()
+		return fmt.Errorf("invalid plugin response: %w: %w", errPluginDesync, err)
+	}
+	if resp.ID != req.ID {
+		m.stop()
+		return fmt.Errorf("plugin response id %d does not match request id %d: %w", resp.ID, req.ID, errPluginDesync)
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result != nil {
+		return json.Unmarshal(resp.Result, result)
+	}
+	return nil
+}
+
+// invoke calls method, restarting the plugin once if it has exited
+func (m *PluginManager) invoke(ctx context.Context, method string, params any, result any) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cmd == nil {
+		if err := m.start(ctx); err != nil {
+			return err
+		}
+	}
+
+	err := m.call(ctx, method, params, result)
+	if err != nil && isPluginGone(err) {
+		m.stop()
+		if err := m.start(ctx); err != nil {
+			return err
+		}
+		err = m.call(ctx, method, params, result)
+	}
+	return err
+}
+
+func isPluginGone(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, syscall.EPIPE) || errors.Is(err, os.ErrClosed) || errors.Is(err, errPluginDesync)
+}
+
+// Info returns what the plugin announced during initialization
+func (m *PluginManager) Info() PluginInfo {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.info
+}
+
+func (m *PluginManager) Resolve(ctx context.Context, reference string) (string, error) {
+	var result struct {
+		Value string `json:"value"`
+	}
+	if err := m.invoke(ctx, "resolve", map[string]string{"reference": reference}, &result); err != nil {
+		return "", err
+	}
+	return result.Value, nil
+}
+
+func (m *PluginManager) Write(ctx context.Context, reference string, value string) error {
+	if !m.Info().Capabilities.Write {
+		return fmt.Errorf("plugin %s does not support writes", m.Name())
+	}
+	return m.invoke(ctx, "write", map[string]string{"reference": reference, "value": value}, nil)
+}
+
+// ListSecrets asks the plugin for its references if it supports listing,
+// otherwise it returns the configured references.
+func (m *PluginManager) ListSecrets(ctx context.Context) ([]string, error) {
+	if !m.Info().Capabilities.List {
+		return m.secrets, nil
+	}
+	var result struct {
+		References []string `json:"references"`
+	}
+	if err := m.invoke(ctx, "list", nil, &result); err != nil {
+		return nil, err
+	}
+	return result.References, nil
+}
+
+func (m *PluginManager) Name() string {
+	return m.Info().Name
+}
+
+// Close stops the plugin process
+func (m *PluginManager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stop()
+	return nil
+}
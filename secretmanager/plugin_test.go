@@ -0,0 +1,153 @@
+package secretmanager_test
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evict/secrets-fuse/secretmanager"
+	"github.com/evict/secrets-fuse/secretmanager/secretmanagertest"
+)
+
+// buildExamplePlugin compiles the reference plugin into a temporary directory
+func buildExamplePlugin(t *testing.T) string {
+	t.Helper()
+	bin := filepath.Join(t.TempDir(), "secrets-fuse-plugin-example")
+	cmd := exec.Command("go", "build", "-o", bin, "github.com/evict/secrets-fuse/cmd/secrets-fuse-plugin-example")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("building example plugin: %v: %s", err, out)
+	}
+	return bin
+}
+
+func TestExamplePluginConformance(t *testing.T) {
+	bin := buildExamplePlugin(t)
+	store := filepath.Join(t.TempDir(), "store.json")
+
+	m, err := secretmanager.NewPluginManager(context.Background(), nil, secretmanager.PluginConfig{
+		Command: bin,
+		Args:    []string{"-store", store},
+	})
+	if err != nil {
+		t.Fatalf("NewPluginManager: %v", err)
+	}
+	defer m.Close()
+
+	if info := m.Info(); info.Name != "example" || !info.Capabilities.Write || !info.Capabilities.List {
+		t.Errorf("unexpected plugin info: %+v", info)
+	}
+
+	secretmanagertest.Run(t, m, "example://db/password", "example://api-key")
+}
+
+func TestPluginRestartAndErrors(t *testing.T) {
+	bin := buildExamplePlugin(t)
+	store := filepath.Join(t.TempDir(), "store.json")
+	ctx := context.Background()
+
+	m, err := secretmanager.NewPluginManager(ctx, nil, secretmanager.PluginConfig{
+		Command: bin,
+		Args:    []string{"-store", store},
+	})
+	if err != nil {
+		t.Fatalf("NewPluginManager: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Write(ctx, "example://token", "abc"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Resolve(ctx, "example://missing"); err == nil {
+		t.Error("expected plugin error for missing secret")
+	}
+
+	// Simulate a crash; the next call must transparently restart the plugin
+	m.Close()
+	if got, err := m.Resolve(ctx, "example://token"); err != nil || got != "abc" {
+		t.Errorf("Resolve after restart: got %q, %v", got, err)
+	}
+
+	if _, err := secretmanager.NewPluginManager(ctx, nil, secretmanager.PluginConfig{Command: "/bin/true"}); err == nil {
+		t.Error("expected plugin that exits immediately to fail initialization")
+	}
+}
+
+// stuckPlugin answers initialize, then hangs on "hang" references, replies
+// with a stale ID to "stale" ones and stops reading after "deaf" ones
+const stuckPlugin = `while read -r line; do
+  id=$(echo "$line" | sed 's/.*"id":\([0-9]*\).*/\1/')
+  case "$line" in
+    *initialize*) echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"protocol_version\":1,\"name\":\"stuck\"}}" ;;
+    *'"method":"name"'*) echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"error\":{\"code\":-32601,\"message\":\"method not found\"}}" ;;
+    *hang*) exec sleep 60 ;;
+    *stale*) echo "{\"jsonrpc\":\"2.0\",\"id\":0,\"result\":{}}" ;;
+    *deaf*) echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"value\":\"$$\"}}"; exec sleep 60 ;;
+    *) echo "{\"jsonrpc\":\"2.0\",\"id\":$id,\"result\":{\"value\":\"$$\"}}" ;;
+  esac
+done`
+
+func TestPluginTimeoutAndDesync(t *testing.T) {
+	ctx := context.Background()
+	m, err := secretmanager.NewPluginManager(ctx, nil, secretmanager.PluginConfig{
+		Command: "/bin/sh",
+		Args:    []string{"-c", stuckPlugin},
+		Timeout: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewPluginManager: %v", err)
+	}
+	defer m.Close()
+
+	// A plugin without the name method keeps the name from initialize
+	if name := m.Name(); name != "stuck" {
+		t.Errorf("Name() = %q", name)
+	}
+	pid, err := m.Resolve(ctx, "stuck://ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	if _, err := m.Resolve(ctx, "stuck://hang"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("hanging call: got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("hanging call took %v", elapsed)
+	}
+	// The hung plugin was killed and a fresh one answers
+	restarted, err := m.Resolve(ctx, "stuck://ok")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restarted == pid {
+		t.Error("plugin was not restarted after a timeout")
+	}
+
+	// A reply to another request means later replies can't be trusted either
+	if _, err := m.Resolve(ctx, "stuck://stale"); err == nil {
+		t.Error("expected error for mismatched response id")
+	}
+	if got, err := m.Resolve(ctx, "stuck://ok"); err != nil || got == restarted {
+		t.Errorf("plugin was not restarted after a mismatched id: %q, %v", got, err)
+	}
+
+	// A request larger than the pipe buffer can't be written to a plugin
+	// that stopped reading, and the timeout covers that too
+	if _, err := m.Resolve(ctx, "stuck://deaf"); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	if _, err := m.Resolve(ctx, "stuck://"+strings.Repeat("x", 1<<20)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("blocked write: got %v, want deadline exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("blocked write took %v", elapsed)
+	}
+	if _, err := m.Resolve(ctx, "stuck://ok"); err != nil {
+		t.Errorf("plugin was not restarted after a blocked write: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package secretmanager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Router is a SecretManager that dispatches each reference to the provider
+// registered for its URI scheme (e.g. "op" for op://..., "vault" for vault://...).
+type Router struct {
+	mu        sync.RWMutex
+	providers map[string]SecretManager
+}
+
+func NewRouter() *Router {
+	return &Router{
+		providers: make(map[string]SecretManager),
+	}
+}
+
+// Scheme returns the URI scheme of a reference ("op" for "op://vault/item/field")
+func Scheme(reference string) string {
+	scheme, _, ok := strings.Cut(reference, "://")
+	if !ok {
+		return ""
+	}
+	return scheme
+}
+
+// Register adds a provider for scheme. Registering the same scheme twice is an error.
+func (r *Router) Register(scheme string, m SecretManager) error {
+	if scheme == "" || strings.Contains(scheme, "://") {
+		return fmt.Errorf("invalid scheme %q", scheme)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if existing, ok := r.providers[scheme]; ok {
+		return fmt.Errorf("scheme %q already registered to %s", scheme, existing.Name())
+	}
+	r.providers[scheme] = m
+	return nil
+}
+
+// Provider returns the provider responsible for reference
+func (r *Router) Provider(reference string) (SecretManager, error) {
+	scheme := Scheme(reference)
+	if scheme == "" {
+		return nil, fmt.Errorf("reference %q has no scheme", reference)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	m, ok := r.providers[scheme]
+	if !ok {
+		return nil, fmt.Errorf("no provider registered for %s://", scheme)
+	}
+	return m, nil
+}
+
+// Schemes returns the registered schemes in sorted order
+func (r *Router) Schemes() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	schemes := make([]string, 0, len(r.providers))
+	for s := range r.providers {
+		schemes = append(schemes, s)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+func (r *Router) Resolve(ctx context.Context, reference string) (string, error) {
+	m, err := r.Provider(reference)
+	if err != nil {
+		return "", err
+	}
+	return m.Resolve(ctx, reference)
+}
+
+func (r *Router) Write(ctx context.Context, reference string, value string) error {
+	m, err := r.Provider(reference)
+	if err != nil {
+		return err
+	}
+	return m.Write(ctx, reference, value)
+}
+
+func (r *Router) ListSecrets(ctx context.Context) ([]string, error) {
+	var refs []string
+	for _, scheme := range r.Schemes() {
+		m, err := r.Provider(scheme + "://")
+		if err != nil {
+			return nil, err
+		}
+		list, err := m.ListSecrets(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m.Name(), err)
+		}
+		refs = append(refs, list...)
+	}
+	return refs, nil
+}
+
+func (r *Router) Name() string {
+	var names []string
+	for _, scheme := range r.Schemes() {
+		if m, err := r.Provider(scheme + "://"); err == nil {
+			names = append(names, m.Name())
+		}
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,84 @@
+package secretmanager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// stubManager is an in-memory SecretManager for router tests
+type stubManager struct {
+	name    string
+	secrets map[string]string
+}
+
+func (m *stubManager) Resolve(ctx context.Context, reference string) (string, error) {
+	return m.secrets[reference], nil
+}
+
+func (m *stubManager) Write(ctx context.Context, reference string, value string) error {
+	m.secrets[reference] = value
+	return nil
+}
+
+func (m *stubManager) ListSecrets(ctx context.Context) ([]string, error) {
+	var refs []string
+	for ref := range m.secrets {
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func (m *stubManager) Name() string {
+	return m.name
+}
+
+func TestRouterDispatch(t *testing.T) {
+	op := &stubManager{name: "1password", secrets: map[string]string{"op://v/i/f": "from-op"}}
+	vault := &stubManager{name: "vault", secrets: map[string]string{"vault://secret/app#k": "from-vault"}}
+
+	r := NewRouter()
+	if err := r.Register("op", op); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("vault", vault); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("op", vault); err == nil {
+		t.Error("expected duplicate registration to fail")
+	}
+
+	ctx := context.Background()
+	if val, _ := r.Resolve(ctx, "op://v/i/f"); val != "from-op" {
+		t.Errorf("op resolve: got %q", val)
+	}
+	if val, _ := r.Resolve(ctx, "vault://secret/app#k"); val != "from-vault" {
+		t.Errorf("vault resolve: got %q", val)
+	}
+	if _, err := r.Resolve(ctx, "pass://x"); err == nil {
+		t.Error("expected error for unregistered scheme")
+	}
+	if _, err := r.Resolve(ctx, "no-scheme"); err == nil {
+		t.Error("expected error for reference without scheme")
+	}
+
+	if err := r.Write(ctx, "vault://secret/app#k", "updated"); err != nil {
+		t.Fatal(err)
+	}
+	if vault.secrets["vault://secret/app#k"] != "updated" {
+		t.Error("write not routed to vault provider")
+	}
+
+	refs, err := r.ListSecrets(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"op://v/i/f", "vault://secret/app#k"}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("ListSecrets: got %v, want %v", refs, want)
+	}
+
+	if name := r.Name(); name != "1password, vault" {
+		t.Errorf("Name: got %q", name)
+	}
+}
@@ -0,0 +1,77 @@
+// Package secretmanagertest provides a conformance suite for
+// secretmanager.SecretManager implementations, including external plugins.
+package secretmanagertest
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/evict/secrets-fuse/secretmanager"
+)
+
+// values exercises content the FUSE layer passes through unchanged
+var values = []string{
+	"initial-secret-value",
+	"updated-secret-value",
+	"line one\nline two\n",
+	`{"user":"app","password":"p@ss w0rd"}`,
+	"",
+}
+
+// Run checks that m behaves like the providers the FUSE layer expects:
+// a Write is visible to the next Resolve, ListSecrets includes every
+// reference written, and Name is non-empty. refs must be writable
+// references owned by m; their previous contents are overwritten.
+func Run(t *testing.T, m secretmanager.SecretManager, refs ...string) {
+	t.Helper()
+	ctx := context.Background()
+
+	t.Run("Name", func(t *testing.T) {
+		if m.Name() == "" {
+			t.Error("Name returned an empty string")
+		}
+	})
+
+	t.Run("WriteThenResolve", func(t *testing.T) {
+		for _, ref := range refs {
+			for _, want := range values {
+				if err := m.Write(ctx, ref, want); err != nil {
+					t.Fatalf("Write(%s): %v", ref, err)
+				}
+				got, err := m.Resolve(ctx, ref)
+				if err != nil {
+					t.Fatalf("Resolve(%s): %v", ref, err)
+				}
+				if got != want {
+					t.Errorf("Resolve(%s) after Write: got %q, want %q", ref, got, want)
+				}
+			}
+		}
+	})
+
+	t.Run("WritesAreIndependent", func(t *testing.T) {
+		for i, ref := range refs {
+			if err := m.Write(ctx, ref, ref); err != nil {
+				t.Fatalf("Write(%s): %v", ref, err)
+			}
+			for _, other := range refs[:i] {
+				if got, _ := m.Resolve(ctx, other); got != other {
+					t.Errorf("Write(%s) changed %s to %q", ref, other, got)
+				}
+			}
+		}
+	})
+
+	t.Run("ListSecrets", func(t *testing.T) {
+		listed, err := m.ListSecrets(ctx)
+		if err != nil {
+			t.Fatalf("ListSecrets: %v", err)
+		}
+		for _, ref := range refs {
+			if !slices.Contains(listed, ref) {
+				t.Errorf("ListSecrets does not include %s: %v", ref, listed)
+			}
+		}
+	})
+}
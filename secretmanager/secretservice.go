@@ -0,0 +1,319 @@
+package secretmanager
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	ssBusName     = "org.freedesktop.secrets"
+	ssServicePath = dbus.ObjectPath("/org/freedesktop/secrets")
+
+	ssService    = "org.freedesktop.Secret.Service"
+	ssCollection = "org.freedesktop.Secret.Collection"
+	ssItem       = "org.freedesktop.Secret.Item"
+	ssPrompt     = "org.freedesktop.Secret.Prompt"
+)
+
+// SecretServiceConfig configures access to a freedesktop Secret Service
+// (GNOME Keyring, KWallet, KeePassXC)
+type SecretServiceConfig struct {
+	BusAddress string // defaults to the session bus
+}
+
+// ssSecret is the (oayays) Secret struct of the Secret Service API
+type ssSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// SecretServiceManager resolves secretservice://collection/label and
+// secretservice://collection?attr=value references over D-Bus. Locked
+// collections are unlocked through the service's own prompt.
+type SecretServiceManager struct {
+	conn    *dbus.Conn
+	session dbus.ObjectPath
+	secrets []string // configured secret references
+}
+
+func NewSecretServiceManager(ctx context.Context, secrets []string, cfg SecretServiceConfig) (*SecretServiceManager, error) {
+	var (
+		conn *dbus.Conn
+		err  error
+	)
+	if cfg.BusAddress != "" {
+		conn, err = dbus.Connect(cfg.BusAddress, dbus.WithContext(ctx))
+	} else {
+		conn, err = dbus.ConnectSessionBus(dbus.WithContext(ctx))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("connecting to D-Bus: %w", err)
+	}
+
+	// The "plain" algorithm is fine here: the bus is local and the values
+	// end up in plaintext files anyway
+	var output dbus.Variant
+	var session dbus.ObjectPath
+	err = conn.Object(ssBusName, ssServicePath).CallWithContext(ctx, ssService+".OpenSession", 0,
+		"plain", dbus.MakeVariant("")).Store(&output, &session)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("opening Secret Service session: %w", err)
+	}
+
+	return &SecretServiceManager{
+		conn:    conn,
+		session: session,
+		secrets: secrets,
+	}, nil
+}
+
+// ssReference is a parsed secretservice:// reference. Exactly one of label
+// and attributes is set.
+type ssReference struct {
+	collection string
+	label      string
+	attributes map[string]string
+}
+
+func parseSecretServiceReference(reference string) (ssReference, error) {
+	if !strings.HasPrefix(reference, "secretservice://") {
+		return ssReference{}, fmt.Errorf("invalid reference format: must start with secretservice://")
+	}
+	rest, query, hasQuery := strings.Cut(strings.TrimPrefix(reference, "secretservice://"), "?")
+
+	if hasQuery {
+		values, err := url.ParseQuery(query)
+		if err != nil {
+			return ssReference{}, fmt.Errorf("invalid attribute query: %w", err)
+		}
+		ref := ssReference{collection: strings.Trim(rest, "/"), attributes: make(map[string]string)}
+		for k, v := range values {
+			ref.attributes[k] = v[0]
+		}
+		if ref.collection == "" || len(ref.attributes) == 0 {
+			return ssReference{}, fmt.Errorf("invalid reference format: expected secretservice://<collection>?<attr>=<value>")
+		}
+		return ref, nil
+	}
+
+	collection, label, _ := strings.Cut(rest, "/")
+	if collection == "" || label == "" {
+		return ssReference{}, fmt.Errorf("invalid reference format: expected secretservice://<collection>/<label>")
+	}
+	return ssReference{collection: collection, label: label}, nil
+}
+
+// collectionPath finds a collection by alias (e.g. "default"), label or
+// object path basename
+func (m *SecretServiceManager) collectionPath(ctx context.Context, name string) (dbus.ObjectPath, error) {
+	service := m.conn.Object(ssBusName, ssServicePath)
+
+	var alias dbus.ObjectPath
+	if err := service.CallWithContext(ctx, ssService+".ReadAlias", 0, name).Store(&alias); err == nil && alias != "/" {
+		return alias, nil
+	}
+
+	v, err := service.GetProperty(ssService + ".Collections")
+	if err != nil {
+		return "", fmt.Errorf("listing collections: %w", err)
+	}
+	collections, _ := v.Value().([]dbus.ObjectPath)
+	for _, p := range collections {
+		if path.Base(string(p)) == name {
+			return p, nil
+		}
+		if label, err := m.conn.Object(ssBusName, p).GetProperty(ssCollection + ".Label"); err == nil && label.Value() == name {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("collection %q not found", name)
+}
+
+// findItem returns the item a reference points at, or "" if there is none
+func (m *SecretServiceManager) findItem(ctx context.Context, collection dbus.ObjectPath, ref ssReference) (dbus.ObjectPath, error) {
+	obj := m.conn.Object(ssBusName, collection)
+
+	if ref.attributes != nil {
+		var items []dbus.ObjectPath
+		if err := obj.CallWithContext(ctx, ssCollection+".SearchItems", 0, ref.attributes).Store(&items); err != nil {
+			return "", fmt.Errorf("searching items: %w", err)
+		}
+		if len(items) == 0 {
+			return "", nil
+		}
+		// Pick deterministically if several items share the attributes
+		sort.Slice(items, func(i, j int) bool { return items[i] < items[j] })
+		return items[0], nil
+	}
+
+	v, err := obj.GetProperty(ssCollection + ".Items")
+	if err != nil {
+		return "", fmt.Errorf("listing items: %w", err)
+	}
+	items, _ := v.Value().([]dbus.ObjectPath)
+	for _, item := range items {
+		label, err := m.conn.Object(ssBusName, item).GetProperty(ssItem + ".Label")
+		if err == nil && label.Value() == ref.label {
+			return item, nil
+		}
+	}
+	return "", nil
+}
+
+// unlock unlocks objects, waiting for the user to answer the service's
+// prompt if it shows one
+func (m *SecretServiceManager) unlock(ctx context.Context, objects ...dbus.ObjectPath) error {
+	var unlocked []dbus.ObjectPath
+	var prompt dbus.ObjectPath
+	err := m.conn.Object(ssBusName, ssServicePath).CallWithContext(ctx, ssService+".Unlock", 0, objects).Store(&unlocked, &prompt)
+	if err != nil {
+		return fmt.Errorf("unlocking: %w", err)
+	}
+	if prompt == "/" {
+		return nil
+	}
+	return m.prompt(ctx, prompt)
+}
+
+func (m *SecretServiceManager) prompt(ctx context.Context, prompt dbus.ObjectPath) error {
+	// Subscribe before prompting so the Completed signal can't be missed
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(ssPrompt),
+		dbus.WithMatchMember("Completed"),
+	}
+	if err := m.conn.AddMatchSignalContext(ctx, match...); err != nil {
+		return fmt.Errorf("watching prompt: %w", err)
+	}
+	defer m.conn.RemoveMatchSignal(match...)
+
+	signals := make(chan *dbus.Signal, 8)
+	m.conn.Signal(signals)
+	defer m.conn.RemoveSignal(signals)
+
+	if err := m.conn.Object(ssBusName, prompt).CallWithContext(ctx, ssPrompt+".Prompt", 0, "").Err; err != nil {
+		return fmt.Errorf("prompting: %w", err)
+	}
+
+	for {
+		select {
+		case sig := <-signals:
+			if sig.Path != prompt || sig.Name != ssPrompt+".Completed" || len(sig.Body) == 0 {
+				continue
+			}
+			if dismissed, _ := sig.Body[0].(bool); dismissed {
+				return fmt.Errorf("prompt dismissed")
+			}
+			return nil
+		case <-ctx.Done():
+			m.conn.Object(ssBusName, prompt).Call(ssPrompt+".Dismiss", 0)
+			return ctx.Err()
+		}
+	}
+}
+
+func (m *SecretServiceManager) Resolve(ctx context.Context, reference string) (string, error) {
+	ref, err := parseSecretServiceReference(reference)
+	if err != nil {
+		return "", err
+	}
+	collection, err := m.collectionPath(ctx, ref.collection)
+	if err != nil {
+		return "", err
+	}
+	item, err := m.findItem(ctx, collection, ref)
+	if err != nil {
+		return "", err
+	}
+	if item == "" {
+		return "", fmt.Errorf("secret %s not found", reference)
+	}
+	if err := m.unlock(ctx, item); err != nil {
+		return "", err
+	}
+
+	var secret ssSecret
+	if err := m.conn.Object(ssBusName, item).CallWithContext(ctx, ssItem+".GetSecret", 0, m.session).Store(&secret); err != nil {
+		return "", fmt.Errorf("reading secret %s: %w", reference, err)
+	}
+	return string(secret.Value), nil
+}
+
+// Write creates the item or replaces the one with the same attributes. Items
+// addressed by label keep their existing attributes, so the service replaces
+// them in place instead of adding a duplicate.
+func (m *SecretServiceManager) Write(ctx context.Context, reference string, value string) error {
+	ref, err := parseSecretServiceReference(reference)
+	if err != nil {
+		return err
+	}
+	collection, err := m.collectionPath(ctx, ref.collection)
+	if err != nil {
+		return err
+	}
+	if err := m.unlock(ctx, collection); err != nil {
+		return err
+	}
+
+	label, attributes := ref.label, ref.attributes
+	if attributes == nil {
+		attributes = map[string]string{"label": label}
+		item, err := m.findItem(ctx, collection, ref)
+		if err != nil {
+			return err
+		}
+		if item != "" {
+			if v, err := m.conn.Object(ssBusName, item).GetProperty(ssItem + ".Attributes"); err == nil {
+				if existing, ok := v.Value().(map[string]string); ok {
+					attributes = existing
+				}
+			}
+		}
+	} else {
+		pairs := make([]string, 0, len(attributes))
+		for k, v := range attributes {
+			pairs = append(pairs, k+"="+v)
+		}
+		sort.Strings(pairs)
+		label = strings.Join(pairs, " ")
+	}
+
+	properties := map[string]dbus.Variant{
+		ssItem + ".Label":      dbus.MakeVariant(label),
+		ssItem + ".Attributes": dbus.MakeVariant(attributes),
+	}
+	secret := ssSecret{
+		Session:     m.session,
+		Parameters:  []byte{},
+		Value:       []byte(value),
+		ContentType: "text/plain",
+	}
+
+	var item, prompt dbus.ObjectPath
+	err = m.conn.Object(ssBusName, collection).CallWithContext(ctx, ssCollection+".CreateItem", 0,
+		properties, secret, true).Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("writing secret %s: %w", reference, err)
+	}
+	if prompt != "/" {
+		return m.prompt(ctx, prompt)
+	}
+	return nil
+}
+
+func (m *SecretServiceManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *SecretServiceManager) Name() string {
+	return "secretservice"
+}
@@ -0,0 +1,338 @@
+package secretmanager
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/godbus/dbus/v5"
+)
+
+// startBus runs a private dbus-daemon and returns its address
+func startBus(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("dbus-daemon"); err != nil {
+		t.Skip("dbus-daemon not installed")
+	}
+
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "bus.conf")
+	err := os.WriteFile(conf, []byte(`<busconfig>
+  <type>session</type>
+  <listen>unix:dir=`+dir+`</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("dbus-daemon", "--config-file="+conf, "--print-address", "--nofork")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatalf("reading bus address: %v", err)
+	}
+	return strings.TrimSpace(address)
+}
+
+// fakeSecretService implements the parts of the Secret Service API the
+// manager uses, with one collection that starts out locked
+type fakeSecretService struct {
+	conn *dbus.Conn
+
+	mu       sync.Mutex
+	locked   bool
+	prompts  int
+	items    map[dbus.ObjectPath]*fakeItem
+	nextItem int
+}
+
+// counts returns the number of prompts shown and items stored so far
+func (s *fakeSecretService) counts() (prompts, items int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.prompts, len(s.items)
+}
+
+type fakeItem struct {
+	label      string
+	attributes map[string]string
+	value      []byte
+}
+
+const fakeCollection = dbus.ObjectPath("/org/freedesktop/secrets/collection/login")
+
+type fakeProps struct {
+	get func(name string) (any, bool)
+}
+
+func (p fakeProps) Get(iface, name string) (dbus.Variant, *dbus.Error) {
+	if v, ok := p.get(iface + "." + name); ok {
+		return dbus.MakeVariant(v), nil
+	}
+	return dbus.Variant{}, dbus.MakeFailedError(fmt.Errorf("no property %s.%s", iface, name))
+}
+
+func (p fakeProps) GetAll(iface string) (map[string]dbus.Variant, *dbus.Error) {
+	return nil, dbus.MakeFailedError(fmt.Errorf("GetAll not supported"))
+}
+
+type fakeServiceIface struct{ s *fakeSecretService }
+
+func (f fakeServiceIface) OpenSession(algorithm string, input dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", nil)
+	}
+	return dbus.MakeVariant(""), "/org/freedesktop/secrets/session/1", nil
+}
+
+func (f fakeServiceIface) ReadAlias(name string) (dbus.ObjectPath, *dbus.Error) {
+	if name == "default" {
+		return fakeCollection, nil
+	}
+	return "/", nil
+}
+
+func (f fakeServiceIface) Unlock(objects []dbus.ObjectPath) ([]dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	if !f.s.locked {
+		return objects, "/", nil
+	}
+	return nil, "/org/freedesktop/secrets/prompt/1", nil
+}
+
+type fakePromptIface struct{ s *fakeSecretService }
+
+func (f fakePromptIface) Prompt(windowID string) *dbus.Error {
+	f.s.mu.Lock()
+	f.s.locked = false
+	f.s.prompts++
+	f.s.mu.Unlock()
+	f.s.conn.Emit("/org/freedesktop/secrets/prompt/1", ssPrompt+".Completed", false, dbus.MakeVariant([]dbus.ObjectPath{fakeCollection}))
+	return nil
+}
+
+func (f fakePromptIface) Dismiss() *dbus.Error { return nil }
+
+type fakeCollectionIface struct{ s *fakeSecretService }
+
+func (f fakeCollectionIface) SearchItems(attributes map[string]string) ([]dbus.ObjectPath, *dbus.Error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	var found []dbus.ObjectPath
+	for p, item := range f.s.items {
+		match := true
+		for k, v := range attributes {
+			if item.attributes[k] != v {
+				match = false
+			}
+		}
+		if match {
+			found = append(found, p)
+		}
+	}
+	return found, nil
+}
+
+func (f fakeCollectionIface) CreateItem(properties map[string]dbus.Variant, secret ssSecret, replace bool) (dbus.ObjectPath, dbus.ObjectPath, *dbus.Error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	if f.s.locked {
+		return "", "", dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+	label, _ := properties[ssItem+".Label"].Value().(string)
+	attributes, _ := properties[ssItem+".Attributes"].Value().(map[string]string)
+	if replace {
+		for p, item := range f.s.items {
+			if maps.Equal(item.attributes, attributes) {
+				item.label, item.value = label, secret.Value
+				return p, "/", nil
+			}
+		}
+	}
+	f.s.nextItem++
+	p := dbus.ObjectPath(fmt.Sprintf("%s/%d", fakeCollection, f.s.nextItem))
+	f.s.items[p] = &fakeItem{label: label, attributes: attributes, value: secret.Value}
+	f.s.exportItem(p)
+	return p, "/", nil
+}
+
+type fakeItemIface struct {
+	s    *fakeSecretService
+	path dbus.ObjectPath
+}
+
+func (f fakeItemIface) GetSecret(session dbus.ObjectPath) (ssSecret, *dbus.Error) {
+	f.s.mu.Lock()
+	defer f.s.mu.Unlock()
+	if f.s.locked {
+		return ssSecret{}, dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+	return ssSecret{Session: session, Parameters: []byte{}, Value: f.s.items[f.path].value, ContentType: "text/plain"}, nil
+}
+
+func (s *fakeSecretService) exportItem(p dbus.ObjectPath) {
+	s.conn.Export(fakeItemIface{s, p}, p, ssItem)
+	s.conn.Export(fakeProps{func(name string) (any, bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		item := s.items[p]
+		switch name {
+		case ssItem + ".Label":
+			return item.label, true
+		case ssItem + ".Attributes":
+			return item.attributes, true
+		}
+		return nil, false
+	}}, p, "org.freedesktop.DBus.Properties")
+}
+
+func startFakeSecretService(t *testing.T, address string) *fakeSecretService {
+	t.Helper()
+	conn, err := dbus.Connect(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	s := &fakeSecretService{conn: conn, locked: true, items: make(map[dbus.ObjectPath]*fakeItem)}
+	conn.Export(fakeServiceIface{s}, ssServicePath, ssService)
+	conn.Export(fakeProps{func(name string) (any, bool) {
+		if name == ssService+".Collections" {
+			return []dbus.ObjectPath{fakeCollection}, true
+		}
+		return nil, false
+	}}, ssServicePath, "org.freedesktop.DBus.Properties")
+	conn.Export(fakePromptIface{s}, "/org/freedesktop/secrets/prompt/1", ssPrompt)
+	conn.Export(fakeCollectionIface{s}, fakeCollection, ssCollection)
+	conn.Export(fakeProps{func(name string) (any, bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		switch name {
+		case ssCollection + ".Label":
+			return "Login", true
+		case ssCollection + ".Items":
+			items := make([]dbus.ObjectPath, 0, len(s.items))
+			for p := range s.items {
+				items = append(items, p)
+			}
+			return items, true
+		}
+		return nil, false
+	}}, fakeCollection, "org.freedesktop.DBus.Properties")
+
+	if reply, err := conn.RequestName(ssBusName, dbus.NameFlagDoNotQueue); err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		t.Fatalf("claiming %s: %v (reply %d)", ssBusName, err, reply)
+	}
+	return s
+}
+
+func TestParseSecretServiceReference(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    ssReference
+		wantErr bool
+	}{
+		{ref: "secretservice://default/GitHub Token", want: ssReference{collection: "default", label: "GitHub Token"}},
+		{ref: "secretservice://login/a/b", want: ssReference{collection: "login", label: "a/b"}},
+		{ref: "secretservice://default?service=github&user=me", want: ssReference{collection: "default", attributes: map[string]string{"service": "github", "user": "me"}}},
+		{ref: "secretservice://default", wantErr: true},
+		{ref: "secretservice://default?", wantErr: true},
+		{ref: "secretservice:///label", wantErr: true},
+		{ref: "pass://default/label", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSecretServiceReference(tt.ref)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", tt.ref, err, tt.wantErr)
+			continue
+		}
+		if got.collection != tt.want.collection || got.label != tt.want.label || !maps.Equal(got.attributes, tt.want.attributes) {
+			t.Errorf("%s: got %+v, want %+v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestSecretServiceManager(t *testing.T) {
+	address := startBus(t)
+	fake := startFakeSecretService(t, address)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	m, err := NewSecretServiceManager(ctx, nil, SecretServiceConfig{BusAddress: address})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	byLabel := "secretservice://default/GitHub Token"
+	byAttrs := "secretservice://Login?service=github&user=me"
+
+	if _, err := m.Resolve(ctx, byLabel); err == nil {
+		t.Fatal("expected missing item to fail")
+	}
+
+	// The collection starts locked, so the first write goes through the prompt
+	if err := m.Write(ctx, byLabel, "ghp_one"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if prompts, _ := fake.counts(); prompts != 1 {
+		t.Errorf("expected 1 prompt, got %d", prompts)
+	}
+	if err := m.Write(ctx, byAttrs, "attr-value"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	if got, err := m.Resolve(ctx, byLabel); err != nil || got != "ghp_one" {
+		t.Errorf("Resolve by label: got %q, %v", got, err)
+	}
+	if got, err := m.Resolve(ctx, byAttrs); err != nil || got != "attr-value" {
+		t.Errorf("Resolve by attributes: got %q, %v", got, err)
+	}
+
+	// Rewriting replaces the existing items instead of adding new ones
+	if err := m.Write(ctx, byLabel, "ghp_two"); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Write(ctx, byAttrs, "attr-two"); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Resolve(ctx, byLabel); got != "ghp_two" {
+		t.Errorf("Resolve after rewrite: got %q", got)
+	}
+	if got, _ := m.Resolve(ctx, byAttrs); got != "attr-two" {
+		t.Errorf("Resolve after rewrite: got %q", got)
+	}
+	if _, items := fake.counts(); items != 2 {
+		t.Errorf("expected 2 items, got %d", items)
+	}
+
+	if _, err := m.Resolve(ctx, "secretservice://nosuch/x"); err == nil {
+		t.Error("expected unknown collection to fail")
+	}
+}
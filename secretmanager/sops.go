@@ -0,0 +1,157 @@
+package secretmanager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// SOPSConfig configures access to SOPS-encrypted YAML/JSON files
+type SOPSConfig struct {
+	Binary     string // defaults to "sops"
+	AgeKeyFile string // passed to sops as SOPS_AGE_KEY_FILE
+	BaseDir    string // relative references are resolved against this directory
+}
+
+// SOPSManager resolves sops://path/file.yaml#.key.path references through
+// the sops binary, which handles age, GPG and cloud KMS keys and keeps the
+// file's SOPS metadata intact on writes.
+type SOPSManager struct {
+	sops       string
+	ageKeyFile string
+	baseDir    string
+	secrets    []string // configured secret references
+}
+
+func NewSOPSManager(ctx context.Context, secrets []string, cfg SOPSConfig) (*SOPSManager, error) {
+	binary := cfg.Binary
+	if binary == "" {
+		binary = "sops"
+	}
+	if _, err := exec.LookPath(binary); err != nil {
+		return nil, fmt.Errorf("sops not found: %w", err)
+	}
+
+	return &SOPSManager{
+		sops:       binary,
+		ageKeyFile: expandHome(cfg.AgeKeyFile),
+		baseDir:    expandHome(cfg.BaseDir),
+		secrets:    secrets,
+	}, nil
+}
+
+// parseSOPSReference extracts the file path and key path from "sops://path#.a.b[0]"
+func parseSOPSReference(reference string) (path string, keys []any, err error) {
+	if !strings.HasPrefix(reference, "sops://") {
+		return "", nil, fmt.Errorf("invalid reference format: must start with sops://")
+	}
+	path, fragment, _ := strings.Cut(strings.TrimPrefix(reference, "sops://"), "#")
+	if path == "" {
+		return "", nil, fmt.Errorf("invalid reference format: expected sops://path/to/file#.key.path")
+	}
+	if keys, err = parseKeyPath(fragment); err != nil {
+		return "", nil, err
+	}
+	return path, keys, nil
+}
+
+// parseKeyPath splits ".a.b[0].c" into ["a", "b", 0, "c"]
+func parseKeyPath(fragment string) ([]any, error) {
+	var keys []any
+	for _, part := range strings.Split(strings.TrimPrefix(fragment, "."), ".") {
+		if part == "" {
+			continue
+		}
+		name, rest, _ := strings.Cut(part, "[")
+		if name != "" {
+			keys = append(keys, name)
+		}
+		for rest != "" {
+			idx, after, ok := strings.Cut(rest, "]")
+			n, err := strconv.Atoi(idx)
+			if !ok || err != nil {
+				return nil, fmt.Errorf("invalid key path %q", fragment)
+			}
+			keys = append(keys, n)
+			rest = strings.TrimPrefix(after, "[")
+		}
+	}
+	return keys, nil
+}
+
+// sopsTreePath formats keys in the syntax of sops --extract and sops set: ["a"]["b"][0]
+func sopsTreePath(keys []any) string {
+	var b strings.Builder
+	for _, k := range keys {
+		switch k := k.(type) {
+		case int:
+			fmt.Fprintf(&b, "[%d]", k)
+		case string:
+			quoted, _ := json.Marshal(k)
+			fmt.Fprintf(&b, "[%s]", quoted)
+		}
+	}
+	return b.String()
+}
+
+func (m *SOPSManager) run(ctx context.Context, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, m.sops, args...)
+	cmd.Stderr = &stderr
+	cmd.Env = os.Environ()
+	if m.ageKeyFile != "" {
+		cmd.Env = append(cmd.Env, "SOPS_AGE_KEY_FILE="+m.ageKeyFile)
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("sops %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (m *SOPSManager) Resolve(ctx context.Context, reference string) (string, error) {
+	path, keys, err := parseSOPSReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"--decrypt"}
+	if len(keys) > 0 {
+		args = append(args, "--extract", sopsTreePath(keys))
+	}
+	out, err := m.run(ctx, append(args, resolvePath(m.baseDir, path))...)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (m *SOPSManager) Write(ctx context.Context, reference string, value string) error {
+	path, keys, err := parseSOPSReference(reference)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("writing a whole sops file is not supported, reference a key with #.key.path")
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	_, err = m.run(ctx, "set", resolvePath(m.baseDir, path), sopsTreePath(keys), string(encoded))
+	return err
+}
+
+func (m *SOPSManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *SOPSManager) Name() string {
+	return "sops"
+}
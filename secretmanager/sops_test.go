@@ -0,0 +1,67 @@
+package secretmanager
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeSOPS installs a script that logs its arguments and environment and prints "decrypted"
+func fakeSOPS(t *testing.T) (binary, logFile string) {
+	t.Helper()
+	dir := t.TempDir()
+	binary = filepath.Join(dir, "sops")
+	logFile = filepath.Join(dir, "log")
+	script := "#!/bin/sh\nfor a in \"$@\"; do echo \"$a\" >> " + logFile + "; done\necho \"key=$SOPS_AGE_KEY_FILE\" >> " + logFile + "\nprintf decrypted\n"
+	if err := os.WriteFile(binary, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return binary, logFile
+}
+
+func TestSOPSCommands(t *testing.T) {
+	binary, logFile := fakeSOPS(t)
+	ctx := context.Background()
+
+	m, err := NewSOPSManager(ctx, nil, SOPSConfig{Binary: binary, AgeKeyFile: "/keys.txt", BaseDir: "/repo"})
+	if err != nil {
+		t.Fatalf("NewSOPSManager: %v", err)
+	}
+
+	val, err := m.Resolve(ctx, "sops://secrets/app.yaml#.db.hosts[1].password")
+	if err != nil || val != "decrypted" {
+		t.Fatalf("Resolve: got %q, %v", val, err)
+	}
+	if err := m.Write(ctx, "sops:///etc/app.json#.token", `new "value"`); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := m.Write(ctx, "sops://secrets/app.yaml", "x"); err == nil {
+		t.Error("expected whole-file write to be rejected")
+	}
+
+	data, _ := os.ReadFile(logFile)
+	got := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		"--decrypt", "--extract", `["db"]["hosts"][1]["password"]`, "/repo/secrets/app.yaml", "key=/keys.txt",
+		"set", "/etc/app.json", `["token"]`, `"new \"value\""`, "key=/keys.txt",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("sops invocations:\ngot  %q\nwant %q", got, want)
+	}
+}
+
+func TestParseKeyPath(t *testing.T) {
+	keys, err := parseKeyPath(".a.b[0][2].c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []any{"a", "b", 0, 2, "c"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("got %v, want %v", keys, want)
+	}
+	if _, err := parseKeyPath(".a[x]"); err == nil {
+		t.Error("expected error for non-numeric index")
+	}
+}
@@ -0,0 +1,43 @@
+package secretmanager
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// expandHome replaces a leading "~" with the user's home directory
+func expandHome(path string) string {
+	if len(path) > 0 && path[0] == '~' {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// readTokenFile reads a credential from disk, refusing files that are
+// accessible by group or others.
+func readTokenFile(path string) (string, error) {
+	path = expandHome(path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token file: %w", err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return "", fmt.Errorf("token file %s has permissions %#o, must not be accessible by group or others", path, perm)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("reading token file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("token file %s is empty", path)
+	}
+	return token, nil
+}
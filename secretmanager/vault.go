@@ -0,0 +1,279 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	vault "github.com/hashicorp/vault/api"
+)
+
+// VaultConfig configures access to a HashiCorp Vault server.
+// Authentication is tried in order: Token, TokenFile, AppRole, VAULT_TOKEN.
+type VaultConfig struct {
+	Address   string // defaults to VAULT_ADDR
+	Namespace string
+
+	Token     string
+	TokenFile string
+
+	RoleID       string
+	SecretID     string
+	SecretIDFile string
+	AppRoleMount string // defaults to "approle"
+
+	KVVersion int // 0 = detect per mount, 1 or 2 to force
+}
+
+type VaultManager struct {
+	client    *vault.Client
+	secrets   []string // configured secret references
+	kvVersion int
+
+	mu       sync.Mutex
+	versions map[string]int // detected KV version per mount
+}
+
+func NewVaultManager(ctx context.Context, secrets []string, cfg VaultConfig) (*VaultManager, error) {
+	vcfg := vault.DefaultConfig()
+	if vcfg.Error != nil {
+		return nil, vcfg.Error
+	}
+	if cfg.Address != "" {
+		vcfg.Address = cfg.Address
+	}
+
+	client, err := vault.NewClient(vcfg)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Namespace != "" {
+		client.SetNamespace(cfg.Namespace)
+	}
+
+	if err := vaultLogin(ctx, client, cfg); err != nil {
+		return nil, err
+	}
+
+	return &VaultManager{
+		client:    client,
+		secrets:   secrets,
+		kvVersion: cfg.KVVersion,
+		versions:  make(map[string]int),
+	}, nil
+}
+
+func vaultLogin(ctx context.Context, client *vault.Client, cfg VaultConfig) error {
+	switch {
+	case cfg.Token != "":
+		client.SetToken(cfg.Token)
+	case cfg.TokenFile != "":
+		token, err := readTokenFile(cfg.TokenFile)
+		if err != nil {
+			return err
+		}
+		client.SetToken(token)
+	case cfg.RoleID != "":
+		secretID := cfg.SecretID
+		if cfg.SecretIDFile != "" {
+			var err error
+			if secretID, err = readTokenFile(cfg.SecretIDFile); err != nil {
+				return err
+			}
+		}
+		mount := cfg.AppRoleMount
+		if mount == "" {
+			mount = "approle"
+		}
+		resp, err := client.Logical().WriteWithContext(ctx, "auth/"+mount+"/login", map[string]any{
+			"role_id":   cfg.RoleID,
+			"secret_id": secretID,
+		})
+		if err != nil {
+			return fmt.Errorf("approle login: %w", err)
+		}
+		if resp == nil || resp.Auth == nil || resp.Auth.ClientToken == "" {
+			return fmt.Errorf("approle login: no token in response")
+		}
+		client.SetToken(resp.Auth.ClientToken)
+	case os.Getenv("VAULT_TOKEN") != "":
+		// picked up by vault.NewClient
+	default:
+		return fmt.Errorf("no vault credentials configured (token, token_file, role_id or VAULT_TOKEN)")
+	}
+	return nil
+}
+
+// parseVaultReference extracts mount, path and key from "vault://mount/path#key"
+func parseVaultReference(reference string) (mount, path, key string, err error) {
+	if !strings.HasPrefix(reference, "vault://") {
+		return "", "", "", fmt.Errorf("invalid reference format: must start with vault://")
+	}
+	rest := strings.TrimPrefix(reference, "vault://")
+	rest, key, _ = strings.Cut(rest, "#")
+	mount, path, _ = strings.Cut(strings.Trim(rest, "/"), "/")
+	if mount == "" || path == "" {
+		return "", "", "", fmt.Errorf("invalid reference format: expected vault://mount/path#key")
+	}
+	return mount, path, key, nil
+}
+
+// mountVersion returns the KV engine version for mount
+func (m *VaultManager) mountVersion(ctx context.Context, mount string) (int, error) {
+	if m.kvVersion != 0 {
+		return m.kvVersion, nil
+	}
+
+	m.mu.Lock()
+	v, ok := m.versions[mount]
+	m.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	// Concurrent first lookups may both ask; they get the same answer
+	secret, err := m.client.Logical().ReadWithContext(ctx, "sys/internal/ui/mounts/"+mount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to detect kv version for %s: %w", mount, err)
+	}
+
+	version := 1
+	if secret != nil {
+		if opts, ok := secret.Data["options"].(map[string]any); ok && opts["version"] == "2" {
+			version = 2
+		}
+	}
+	m.mu.Lock()
+	m.versions[mount] = version
+	m.mu.Unlock()
+	return version, nil
+}
+
+// read returns the secret data at path along with its current version (0 for KV v1)
+func (m *VaultManager) read(ctx context.Context, mount, path string) (map[string]any, int64, error) {
+	version, err := m.mountVersion(ctx, mount)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if version == 1 {
+		secret, err := m.client.Logical().ReadWithContext(ctx, mount+"/"+path)
+		if err != nil {
+			return nil, 0, err
+		}
+		if secret == nil {
+			return nil, 0, nil
+		}
+		return secret.Data, 0, nil
+	}
+
+	secret, err := m.client.Logical().ReadWithContext(ctx, mount+"/data/"+path)
+	if err != nil {
+		return nil, 0, err
+	}
+	if secret == nil {
+		return nil, 0, nil
+	}
+
+	var current int64
+	if meta, ok := secret.Data["metadata"].(map[string]any); ok {
+		if n, ok := meta["version"].(json.Number); ok {
+			current, _ = n.Int64()
+		}
+	}
+	data, _ := secret.Data["data"].(map[string]any)
+	return data, current, nil
+}
+
+func (m *VaultManager) Resolve(ctx context.Context, reference string) (string, error) {
+	mount, path, key, err := parseVaultReference(reference)
+	if err != nil {
+		return "", err
+	}
+
+	data, _, err := m.read(ctx, mount, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s/%s: %w", mount, path, err)
+	}
+	if data == nil {
+		return "", fmt.Errorf("secret %s/%s not found", mount, path)
+	}
+
+	if key == "" {
+		out, err := json.Marshal(data)
+		if err != nil {
+			return "", err
+		}
+		return string(out), nil
+	}
+
+	val, ok := data[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found in %s/%s", key, mount, path)
+	}
+	if s, ok := val.(string); ok {
+		return s, nil
+	}
+	out, err := json.Marshal(val)
+	if err != nil {
+		return "", err
+	}
+	return string(out), nil
+}
+
+func (m *VaultManager) Write(ctx context.Context, reference string, value string) error {
+	mount, path, key, err := parseVaultReference(reference)
+	if err != nil {
+		return err
+	}
+
+	version, err := m.mountVersion(ctx, mount)
+	if err != nil {
+		return err
+	}
+
+	data, current, err := m.read(ctx, mount, path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s/%s: %w", mount, path, err)
+	}
+
+	if key == "" {
+		data = make(map[string]any)
+		if err := json.Unmarshal([]byte(value), &data); err != nil {
+			return fmt.Errorf("writing whole secret requires a JSON object: %w", err)
+		}
+	} else {
+		if data == nil {
+			data = make(map[string]any)
+		}
+		data[key] = value
+	}
+
+	if version == 1 {
+		if _, err := m.client.Logical().WriteWithContext(ctx, mount+"/"+path, data); err != nil {
+			return fmt.Errorf("failed to write %s/%s: %w", mount, path, err)
+		}
+		return nil
+	}
+
+	// Check-and-set against the version we read so concurrent edits are not lost
+	_, err = m.client.Logical().WriteWithContext(ctx, mount+"/data/"+path, map[string]any{
+		"data":    data,
+		"options": map[string]any{"cas": current},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s/%s (cas=%d): %w", mount, path, current, err)
+	}
+	return nil
+}
+
+func (m *VaultManager) ListSecrets(ctx context.Context) ([]string, error) {
+	return m.secrets, nil
+}
+
+func (m *VaultManager) Name() string {
+	return "vault"
+}
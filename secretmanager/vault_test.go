@@ -0,0 +1,227 @@
+package secretmanager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault is a minimal stand-in for a Vault server with one KV v2 mount
+// ("secret") and one KV v1 mount ("kv").
+type fakeVault struct {
+	mu      sync.Mutex
+	token   string
+	v2      map[string]map[string]any
+	version map[string]int64
+	v1      map[string]map[string]any
+}
+
+func newFakeVault(token string) *fakeVault {
+	return &fakeVault{
+		token:   token,
+		v2:      make(map[string]map[string]any),
+		version: make(map[string]int64),
+		v1:      make(map[string]map[string]any),
+	}
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	if path == "auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			http.Error(w, `{"errors":["invalid role or secret ID"]}`, http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": v.token}})
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != v.token {
+		http.Error(w, `{"errors":["permission denied"]}`, http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(path, "sys/internal/ui/mounts/"):
+		version := "1"
+		if strings.TrimPrefix(path, "sys/internal/ui/mounts/") == "secret" {
+			version = "2"
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"options": map[string]any{"version": version}}})
+
+	case strings.HasPrefix(path, "secret/data/"):
+		key := strings.TrimPrefix(path, "secret/data/")
+		if r.Method == http.MethodGet {
+			data, ok := v.v2[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+				"data":     data,
+				"metadata": map[string]any{"version": v.version[key]},
+			}})
+			return
+		}
+		var body struct {
+			Data    map[string]any `json:"data"`
+			Options struct {
+				CAS *int64 `json:"cas"`
+			} `json:"options"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Options.CAS == nil || *body.Options.CAS != v.version[key] {
+			http.Error(w, `{"errors":["check-and-set parameter did not match the current version"]}`, http.StatusBadRequest)
+			return
+		}
+		v.v2[key] = body.Data
+		v.version[key]++
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"version": v.version[key]}})
+
+	case strings.HasPrefix(path, "kv/"):
+		key := strings.TrimPrefix(path, "kv/")
+		if r.Method == http.MethodGet {
+			data, ok := v.v1[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				w.Write([]byte(`{"errors":[]}`))
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]any{"data": data})
+			return
+		}
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		v.v1[key] = body
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestVaultKVv2ResolveAndWrite(t *testing.T) {
+	fake := newFakeVault("root")
+	fake.v2["app/db"] = map[string]any{"password": "hunter2", "user": "app"}
+	fake.version["app/db"] = 3
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	ctx := context.Background()
+	m, err := NewVaultManager(ctx, nil, VaultConfig{Address: srv.URL, Token: "root"})
+	if err != nil {
+		t.Fatalf("NewVaultManager: %v", err)
+	}
+
+	ref := "vault://secret/app/db#password"
+	val, err := m.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatalf("Resolve: %v", err)
+	}
+	if val != "hunter2" {
+		t.Errorf("Resolve: got %q, want %q", val, "hunter2")
+	}
+
+	if err := m.Write(ctx, ref, "correct-horse"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if fake.version["app/db"] != 4 {
+		t.Errorf("expected new version 4, got %d", fake.version["app/db"])
+	}
+	if _, ok := fake.v2["app/db"]["password_previous"]; ok {
+		t.Error("KV v2 write should not create a _previous key")
+	}
+	if fake.v2["app/db"]["user"] != "app" {
+		t.Errorf("other keys not preserved: %v", fake.v2["app/db"])
+	}
+
+	val, err = m.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatalf("Resolve after write: %v", err)
+	}
+	if val != "correct-horse" {
+		t.Errorf("Resolve after write: got %q, want %q", val, "correct-horse")
+	}
+}
+
+func TestVaultKVv1Write(t *testing.T) {
+	fake := newFakeVault("root")
+	fake.v1["app"] = map[string]any{"token": "old"}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	ctx := context.Background()
+	m, err := NewVaultManager(ctx, nil, VaultConfig{Address: srv.URL, Token: "root"})
+	if err != nil {
+		t.Fatalf("NewVaultManager: %v", err)
+	}
+
+	if err := m.Write(ctx, "vault://kv/app#token", "new"); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, ok := fake.v1["app"]["token_previous"]; ok || fake.v1["app"]["token"] != "new" {
+		t.Errorf("unexpected data after write: %v", fake.v1["app"])
+	}
+}
+
+func TestVaultAppRoleAndTokenFile(t *testing.T) {
+	fake := newFakeVault("approle-token")
+	fake.v2["app"] = map[string]any{"key": "value"}
+	srv := httptest.NewServer(fake)
+	defer srv.Close()
+
+	ctx := context.Background()
+	m, err := NewVaultManager(ctx, nil, VaultConfig{Address: srv.URL, RoleID: "role", SecretID: "secret"})
+	if err != nil {
+		t.Fatalf("NewVaultManager (approle): %v", err)
+	}
+	if val, err := m.Resolve(ctx, "vault://secret/app#key"); err != nil || val != "value" {
+		t.Errorf("Resolve via approle: got %q, %v", val, err)
+	}
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("approle-token\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewVaultManager(ctx, nil, VaultConfig{Address: srv.URL, TokenFile: tokenFile}); err == nil {
+		t.Error("expected world-readable token file to be rejected")
+	}
+
+	os.Chmod(tokenFile, 0600)
+	m, err = NewVaultManager(ctx, nil, VaultConfig{Address: srv.URL, TokenFile: tokenFile})
+	if err != nil {
+		t.Fatalf("NewVaultManager (token file): %v", err)
+	}
+	if val, err := m.Resolve(ctx, "vault://secret/app#key"); err != nil || val != "value" {
+		t.Errorf("Resolve via token file: got %q, %v", val, err)
+	}
+}
+
+func TestParseVaultReference(t *testing.T) {
+	mount, path, key, err := parseVaultReference("vault://secret/team/app#api_key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mount != "secret" || path != "team/app" || key != "api_key" {
+		t.Errorf("got mount=%q path=%q key=%q", mount, path, key)
+	}
+
+	for _, bad := range []string{"op://a/b/c", "vault://secret", "vault:///#key"} {
+		if _, _, _, err := parseVaultReference(bad); err == nil {
+			t.Errorf("expected error for %q", bad)
+		}
+	}
+}
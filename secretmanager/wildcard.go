@@ -0,0 +1,110 @@
+package secretmanager
+
+import (
+	"context"
+	"path"
+	"strings"
+)
+
+// Expansion is one concrete reference matched by a wildcard pattern. Path
+// holds display names for the segments from the first wildcard onward, e.g.
+// ["Database", "password"] for "op://Vault/*/password".
+type Expansion struct {
+	Reference string
+	Path      []string
+}
+
+// Expander is implemented by providers that can enumerate their own secrets
+// to match wildcard patterns. Others are matched against ListSecrets.
+type Expander interface {
+	Expand(ctx context.Context, pattern string) ([]Expansion, error)
+}
+
+// IsWildcard reports whether reference contains glob metacharacters. Only the
+// path counts: a "#" fragment such as "#.hosts[0]" is a key path, and a "?"
+// starting a "key=value" query, as in "op://v/i/f?attribute=otp", is not one.
+func IsWildcard(reference string) bool {
+	reference, _, _ = strings.Cut(reference, "#")
+	if i := strings.LastIndex(reference, "?"); i != -1 && strings.Contains(reference[i:], "=") {
+		reference = reference[:i]
+	}
+	return strings.ContainsAny(reference, "*?[")
+}
+
+// WildcardPrefix returns the part of pattern before its first wildcard
+// segment ("op://Vault" for "op://Vault/*/password").
+func WildcardPrefix(pattern string) string {
+	scheme, rest, ok := strings.Cut(pattern, "://")
+	if !ok {
+		return pattern
+	}
+	var prefix []string
+	for _, seg := range strings.Split(rest, "/") {
+		if IsWildcard(seg) {
+			break
+		}
+		prefix = append(prefix, seg)
+	}
+	return scheme + "://" + strings.Join(prefix, "/")
+}
+
+// Expand resolves pattern into concrete references using m's Expander if it
+// has one, falling back to filtering m.ListSecrets segment by segment.
+func Expand(ctx context.Context, m SecretManager, pattern string) ([]Expansion, error) {
+	if e, ok := m.(Expander); ok {
+		return e.Expand(ctx, pattern)
+	}
+
+	refs, err := m.ListSecrets(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matches []Expansion
+	for _, ref := range refs {
+		if IsWildcard(ref) {
+			continue
+		}
+		if p, ok := matchSegments(pattern, ref); ok {
+			matches = append(matches, Expansion{Reference: ref, Path: p})
+		}
+	}
+	return matches, nil
+}
+
+// matchSegments matches ref against pattern one "/"-separated segment at a
+// time, returning ref's segments from the first wildcard onward.
+func matchSegments(pattern, ref string) ([]string, bool) {
+	if Scheme(pattern) != Scheme(ref) {
+		return nil, false
+	}
+	_, patternPath, _ := strings.Cut(pattern, "://")
+	_, refPath, _ := strings.Cut(ref, "://")
+	patternSegs := strings.Split(patternPath, "/")
+	refSegs := strings.Split(refPath, "/")
+	if len(patternSegs) != len(refSegs) {
+		return nil, false
+	}
+
+	first := -1
+	for i, seg := range patternSegs {
+		if ok, _ := path.Match(seg, refSegs[i]); !ok {
+			return nil, false
+		}
+		if first == -1 && IsWildcard(seg) {
+			first = i
+		}
+	}
+	if first == -1 {
+		return nil, false
+	}
+	return refSegs[first:], true
+}
+
+// Expand dispatches pattern to the provider registered for its scheme
+func (r *Router) Expand(ctx context.Context, pattern string) ([]Expansion, error) {
+	m, err := r.Provider(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return Expand(ctx, m, pattern)
+}
@@ -0,0 +1,71 @@
+package secretmanager
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestIsWildcard(t *testing.T) {
+	for ref, want := range map[string]bool{
+		"op://Vault/*/password":                     true,
+		"op://Vault/Item/pass?word":                 true,
+		"op://Vault/Item/field":                     false,
+		"op://Vault/Item?format=yaml":               false,
+		"op://Vault/*?format=yaml":                  true,
+		"op://Vault/Item/f?attribute=otp":           false,
+		"sops://secrets.yaml#.db.hosts[0].password": false,
+		"file://x.json#.a[0]":                       false,
+		"vault://secret/app#key?":                   false,
+		"sops://*.yaml#.db.password":                true,
+	} {
+		if got := IsWildcard(ref); got != want {
+			t.Errorf("%s: got %v, want %v", ref, got, want)
+		}
+	}
+}
+
+func TestWildcardPrefix(t *testing.T) {
+	for pattern, want := range map[string]string{
+		"op://Vault/*/password": "op://Vault",
+		"op://Vault/Item/*":     "op://Vault/Item",
+		"op://*/*/*":            "op://",
+		"k8s://prod/app-?/key":  "k8s://prod",
+	} {
+		if got := WildcardPrefix(pattern); got != want {
+			t.Errorf("%s: got %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestExpandFallsBackToListSecrets(t *testing.T) {
+	m := &stubManager{name: "k8s", secrets: map[string]string{
+		"k8s://prod/db/password":  "a",
+		"k8s://prod/db/user":      "b",
+		"k8s://prod/api/password": "c",
+		"k8s://dev/db/password":   "d",
+		"k8s://prod/*/password":   "",
+	}}
+	r := NewRouter()
+	if err := r.Register("k8s", m); err != nil {
+		t.Fatal(err)
+	}
+
+	matches, err := Expand(context.Background(), r, "k8s://prod/*/password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].Reference < matches[j].Reference })
+	want := []Expansion{
+		{Reference: "k8s://prod/api/password", Path: []string{"api", "password"}},
+		{Reference: "k8s://prod/db/password", Path: []string{"db", "password"}},
+	}
+	if !reflect.DeepEqual(matches, want) {
+		t.Errorf("got %v, want %v", matches, want)
+	}
+
+	if _, err := Expand(context.Background(), r, "vault://*"); err == nil {
+		t.Error("expected unregistered scheme to fail")
+	}
+}